@@ -9,11 +9,24 @@ import (
 
 // Image represents a CloudControl image as a Packer Artifact.
 type Image struct {
-	Image       compute.Image
-	BuilderID   string
+	Image     compute.Image
+	BuilderID string
+
+	// The Id of the image (if any) from which the image was created.
+	SourceImageID string
+
 	deleteImage func() error
 }
 
+// NewImage creates a new Image artifact whose customer image will be deleted (using the specified function) when the artifact is destroyed.
+func NewImage(image compute.Image, builderID string, deleteImage func() error) *Image {
+	return &Image{
+		Image:       image,
+		BuilderID:   builderID,
+		deleteImage: deleteImage,
+	}
+}
+
 // BuilderId returns the ID of the builder that was used to create the artifact.
 func (artifact *Image) BuilderId() string {
 	return artifact.BuilderID
@@ -34,17 +47,45 @@ func (artifact *Image) Id() string {
 // Returns human-readable output that describes the artifact created.
 // This is used for UI output. It can be multiple lines.
 func (artifact *Image) String() string {
-	return fmt.Sprintf("Customer image '%s' ('%s') in datacenter '%s'.",
+	operatingSystem := artifact.Image.GetOS()
+
+	return fmt.Sprintf("Customer image '%s' ('%s') in datacenter '%s' (OS: '%s', guest OS customisation: %t).",
 		artifact.Image.GetName(),
 		artifact.Image.GetID(),
 		artifact.Image.GetDatacenterID(),
+		operatingSystem.ID,
+		artifact.Image.RequiresCustomization(),
 	)
 }
 
 // State allows the caller to ask for builder specific state information
 // relating to the artifact instance.
+//
+// Supported state keys are "image_id", "image_name", "datacenter_id", "os_type", "os_family",
+// "guest_os_customization", "created_at", "source_image_id", and "state".
 func (artifact *Image) State(name string) interface{} {
-	return artifact.Image.GetState()
+	switch name {
+	case "image_id":
+		return artifact.Image.GetID()
+	case "image_name":
+		return artifact.Image.GetName()
+	case "datacenter_id":
+		return artifact.Image.GetDatacenterID()
+	case "os_type":
+		return artifact.Image.GetOS().ID
+	case "os_family":
+		return artifact.Image.GetOS().Family
+	case "guest_os_customization":
+		return artifact.Image.RequiresCustomization()
+	case "created_at":
+		return GetImageCreateTime(artifact.Image)
+	case "source_image_id":
+		return artifact.SourceImageID
+	case "state":
+		return artifact.Image.GetState()
+	default:
+		return nil
+	}
 }
 
 // Destroy deletes the artifact. Packer calls this for various reasons,
@@ -62,3 +103,17 @@ func (artifact *Image) Destroy() error {
 }
 
 var _ packer.Artifact = &Image{}
+
+// GetImageCreateTime retrieves the creation time of an OS or customer image (or an empty string if it is not available).
+//
+// CloudControl timestamps are in a fixed-width ISO-8601 format, so they can be compared as strings.
+func GetImageCreateTime(image compute.Image) string {
+	switch typedImage := image.(type) {
+	case *compute.CustomerImage:
+		return typedImage.CreateTime
+	case *compute.OSImage:
+		return typedImage.CreateTime
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,95 @@
+package artifacts
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/packer/packer"
+)
+
+// Images represents a set of CloudControl images (e.g. copies of the same image in different datacenters) as a Packer Artifact.
+type Images struct {
+	Images    []*Image
+	BuilderID string
+}
+
+// BuilderId returns the ID of the builder that was used to create the artifact.
+func (artifact *Images) BuilderId() string {
+	return artifact.BuilderID
+}
+
+// Files determines the set of files that comprise the artifact.
+// If an artifact is not made up of files, then this will be empty.
+func (artifact *Images) Files() []string {
+	return []string{}
+}
+
+// Id gets the ID for the artifact.
+// In this case, it's a comma-separated list of the image Ids.
+func (artifact *Images) Id() string {
+	return strings.Join(artifact.getImageIDs(), ",")
+}
+
+// Returns human-readable output that describes the artifact created.
+// This is used for UI output. It can be multiple lines.
+func (artifact *Images) String() string {
+	result := fmt.Sprintf("%d customer image(s):\n", len(artifact.Images))
+	for _, image := range artifact.Images {
+		result += fmt.Sprintf("- %s\n", image.String())
+	}
+
+	return result
+}
+
+// State allows the caller to ask for builder specific state information
+// relating to the artifact instance.
+//
+// Supported state keys are "image_ids", "datacenter_ids", and "images" (a map of datacenter Ids to image Ids).
+func (artifact *Images) State(name string) interface{} {
+	switch name {
+	case "image_ids":
+		return artifact.getImageIDs()
+	case "datacenter_ids":
+		datacenterIDs := make([]string, len(artifact.Images))
+		for index, image := range artifact.Images {
+			datacenterIDs[index] = image.Image.GetDatacenterID()
+		}
+
+		return datacenterIDs
+	case "images":
+		imageIDsByDatacenter := make(map[string]string)
+		for _, image := range artifact.Images {
+			imageIDsByDatacenter[image.Image.GetDatacenterID()] = image.Image.GetID()
+		}
+
+		return imageIDsByDatacenter
+	default:
+		return nil
+	}
+}
+
+// Destroy deletes the artifact. Packer calls this for various reasons,
+// such as if a post-processor has processed this artifact and it is
+// no longer needed.
+func (artifact *Images) Destroy() (err error) {
+	for _, image := range artifact.Images {
+		destroyError := image.Destroy()
+		if destroyError != nil {
+			err = packer.MultiErrorAppend(err, destroyError)
+		}
+	}
+
+	return
+}
+
+var _ packer.Artifact = &Images{}
+
+// Get the Ids of the images that comprise the artifact.
+func (artifact *Images) getImageIDs() []string {
+	imageIDs := make([]string, len(artifact.Images))
+	for index, image := range artifact.Images {
+		imageIDs[index] = image.Image.GetID()
+	}
+
+	return imageIDs
+}
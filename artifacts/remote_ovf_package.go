@@ -10,10 +10,22 @@ import (
 type RemoteOVFPackage struct {
 	FTPSHostName       string
 	PackagePrefix      string
+	PackageFiles       []string
 	BuilderID          string
 	deletePackageFiles func() error
 }
 
+// NewRemoteOVFPackage creates a new RemoteOVFPackage artifact whose files will be deleted (using the specified function) when the artifact is destroyed.
+func NewRemoteOVFPackage(ftpsHostName string, packagePrefix string, packageFiles []string, builderID string, deletePackageFiles func() error) *RemoteOVFPackage {
+	return &RemoteOVFPackage{
+		FTPSHostName:       ftpsHostName,
+		PackagePrefix:      packagePrefix,
+		PackageFiles:       packageFiles,
+		BuilderID:          builderID,
+		deletePackageFiles: deletePackageFiles,
+	}
+}
+
 // BuilderId returns the ID of the builder that was used to create the artifact.
 func (artifact *RemoteOVFPackage) BuilderId() string {
 	return artifact.BuilderID
@@ -45,8 +57,19 @@ func (artifact *RemoteOVFPackage) String() string {
 
 // State allows the caller to ask for builder specific state information
 // relating to the artifact instance.
+//
+// Supported state keys are "ftps_host", "package_prefix", and "package_files".
 func (artifact *RemoteOVFPackage) State(name string) interface{} {
-	return nil // No specific state.
+	switch name {
+	case "ftps_host":
+		return artifact.FTPSHostName
+	case "package_prefix":
+		return artifact.PackagePrefix
+	case "package_files":
+		return artifact.PackageFiles
+	default:
+		return nil
+	}
 }
 
 // Destroy deletes the artifact. Packer calls this for various reasons,
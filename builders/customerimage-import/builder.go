@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/DimensionDataResearch/go-dd-cloud-compute/compute"
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/artifacts"
 	"github.com/DimensionDataResearch/packer-plugins-ddcloud/builders/customerimage-import/config"
 	"github.com/DimensionDataResearch/packer-plugins-ddcloud/helpers"
 	"github.com/DimensionDataResearch/packer-plugins-ddcloud/steps"
@@ -75,14 +76,39 @@ func (builder *Builder) Prepare(settings ...interface{}) (warnings []string, err
 	}
 
 	// Configure builder execution logic.
-	builder.runner = &multistep.BasicRunner{
-		Steps: []multistep.Step{
-			&steps.ResolveDatacenter{
-				DatacenterID: builder.settings.DatacenterID,
-				AsTarget:     true,
+	builderSteps := []multistep.Step{
+		&steps.ResolveDatacenter{
+			DatacenterID: builder.settings.DatacenterID,
+			AsTarget:     true,
+		},
+		&steps.CheckTargetImage{
+			TargetImage: builder.settings.GetTargetImageName(),
+			Force:       builder.settings.Force,
+		},
+	}
+	if builder.settings.OVFPackageDirectory != "" {
+		// Upload the local OVF package first.
+		builderSteps = append(builderSteps,
+			&steps.ExtractOVA{},
+			&steps.ConvertVMXToOVF{
+				PackageName: builder.settings.OVFPackagePrefix,
+				OutputDir:   "",   // Create a new use new temporary directory
+				CleanupOVF:  true, // Delete once builder is done.
 			},
-			// TODO: Implement ImportCustomerImage step.
+			&steps.PrepareOVFManifest{},
+			&steps.RewriteOVFDescriptor{},
+			&steps.UploadOVFPackage{},
+		)
+	}
+	builderSteps = append(builderSteps,
+		&steps.ImportCustomerImage{
+			TargetImageName:  builder.settings.GetTargetImageName(),
+			DatacenterID:     builder.settings.DatacenterID,
+			OVFPackagePrefix: builder.settings.OVFPackagePrefix,
 		},
+	)
+	builder.runner = &multistep.BasicRunner{
+		Steps: builderSteps,
 	}
 
 	return
@@ -103,6 +129,15 @@ func (builder *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache)
 	stepState.SetSettings(settings)
 	stepState.SetClient(client)
 	stepState.SetBuilderID(BuilderID)
+
+	if settings.OVFPackageDirectory != "" {
+		packageArtifact, err := artifacts.NewFromFilesInLocalDirectory(settings.OVFPackageDirectory, "ddcloud.ovf")
+		if err != nil {
+			return nil, err
+		}
+		stepState.SetSourceArtifact(packageArtifact)
+	}
+
 	builder.runner.Run(stepState.Data)
 
 	err := stepState.GetLastError()
@@ -112,7 +147,6 @@ func (builder *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache)
 
 	imageArtifact := stepState.GetTargetImageArtifact()
 	if imageArtifact == nil {
-		// TODO: This currently fails because the step sequence has not actually been implemented yet.
 		return nil, fmt.Errorf("One or more steps failed to complete")
 	}
 
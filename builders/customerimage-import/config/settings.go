@@ -21,6 +21,12 @@ type Settings struct {
 	DatacenterID     string `mapstructure:"datacenter"`
 	OVFPackagePrefix string `mapstructure:"ovf_package_prefix"`
 	TargetImage      string `mapstructure:"target_image"`
+
+	TargetImageSuffix string `mapstructure:"target_image_suffix"` // e.g. "-{{timestamp}}"
+	Force             bool   `mapstructure:"force"`               // Replace an existing image with the same name.
+
+	// If specified, the OVF package (or OVA archive) in this local directory is uploaded before being imported.
+	OVFPackageDirectory string `mapstructure:"ovf_package_directory"`
 }
 
 var _ helpers.PluginConfig = &Settings{}
@@ -45,6 +51,11 @@ func (settings *Settings) GetMCPPassword() string {
 	return settings.McpPassword
 }
 
+// GetTargetImageName retrieves the name of the customer image to create (TargetImage, followed by TargetImageSuffix if specified).
+func (settings *Settings) GetTargetImageName() string {
+	return settings.TargetImage + settings.TargetImageSuffix
+}
+
 // Validate determines if the settings is valid.
 func (settings *Settings) Validate() (err error) {
 	if settings.McpRegion == "" {
@@ -89,6 +100,16 @@ func (settings *Settings) Validate() (err error) {
 			fmt.Errorf("'ovf_package_prefix' has not been specified in settings"),
 		)
 	}
+	if settings.OVFPackageDirectory != "" {
+		directoryInfo, statError := os.Stat(settings.OVFPackageDirectory)
+		if statError != nil {
+			err = packer.MultiErrorAppend(err, statError)
+		} else if !directoryInfo.IsDir() {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("'ovf_package_directory' ('%s') is not a directory", settings.OVFPackageDirectory),
+			)
+		}
+	}
 
 	return
 }
@@ -58,6 +58,11 @@ func (builder *Builder) Prepare(settings ...interface{}) (warnings []string, err
 		return
 	}
 
+	sourceImageFilter, err := getSourceImageFilter(builder.settings)
+	if err != nil {
+		return
+	}
+
 	builder.client = compute.NewClient(
 		builder.settings.McpRegion,
 		builder.settings.McpUser,
@@ -79,21 +84,27 @@ func (builder *Builder) Prepare(settings ...interface{}) (warnings []string, err
 			&steps.ResolveSourceImage{
 				ImageName:    builder.settings.SourceImage,
 				DatacenterID: builder.settings.DatacenterID,
+				Filter:       sourceImageFilter,
 			},
 			&steps.CheckTargetImage{
-				TargetImage: builder.settings.TargetImage,
+				TargetImage: builder.settings.GetTargetImageName(),
+				Force:       builder.settings.Force,
 			},
+			&steps.ResolveClientIP{},
 			&steps.DeployServer{},
 			&steps.CreateNATRule{},
 			&steps.CreateFirewallRule{},
+			&steps.InstallTemporarySSHKey{},
 			&communicator.StepConnect{
 				Config:      &builder.settings.CommunicatorConfig,
-				Host:        getSSHHost,
+				Host:        getCommunicatorHost,
 				SSHPort:     getSSHPort,
 				SSHConfig:   getSSHConfig,
+				WinRMPort:   getWinRMPort,
 				WinRMConfig: getWinRMConfig,
 			},
 			&common.StepProvision{},
+			&steps.RemoveTemporarySSHKey{},
 			&steps.CloneServer{},
 		},
 	}
@@ -145,9 +156,33 @@ func createUniquenessKey() string {
 	return hex.EncodeToString(uniquenessKeyBytes)
 }
 
-func getSSHHost(state multistep.StateBag) (host string, err error) {
+func getSourceImageFilter(settings *config.Settings) (*steps.SourceImageFilter, error) {
+	filter := settings.SourceImageFilter
+	if filter == nil {
+		return nil, nil
+	}
+
+	namePattern, err := filter.GetNameRegex()
+	if err != nil {
+		return nil, err
+	}
+
+	return &steps.SourceImageFilter{
+		NamePattern: namePattern,
+		OSFamily:    filter.OSFamily,
+		OSType:      filter.OSType,
+		ImageType:   filter.ImageType,
+		MostRecent:  filter.MostRecent,
+	}, nil
+}
+
+func getCommunicatorHost(state multistep.StateBag) (host string, err error) {
 	settings := state.Get("settings").(*config.Settings)
-	host = settings.CommunicatorConfig.SSHHost
+	if settings.CommunicatorConfig.Type == "winrm" {
+		host = settings.CommunicatorConfig.WinRMHost
+	} else {
+		host = settings.CommunicatorConfig.SSHHost
+	}
 
 	return
 }
@@ -161,11 +196,50 @@ func getSSHPort(state multistep.StateBag) (port int, err error) {
 
 func getSSHConfig(state multistep.StateBag) (clientConfig *gossh.ClientConfig, err error) {
 	settings := state.Get("settings").(*config.Settings)
+	communicatorConfig := settings.CommunicatorConfig
+
+	var authMethods []gossh.AuthMethod
+
+	temporaryPrivateKey := helpers.ForStateBag(state).GetTemporarySSHPrivateKey()
+	if temporaryPrivateKey != nil {
+		var authMethod gossh.AuthMethod
+		authMethod, err = helpers.SSHPrivateKeyAuth(temporaryPrivateKey)
+		if err != nil {
+			return
+		}
+		authMethods = append(authMethods, authMethod)
+	}
+	if communicatorConfig.SSHPrivateKey != "" {
+		var authMethod gossh.AuthMethod
+		authMethod, err = helpers.SSHPrivateKeyFileAuth(communicatorConfig.SSHPrivateKey)
+		if err != nil {
+			return
+		}
+		authMethods = append(authMethods, authMethod)
+	}
+	if communicatorConfig.SSHAgentAuth {
+		var authMethod gossh.AuthMethod
+		authMethod, err = helpers.SSHAgentAuth()
+		if err != nil {
+			return
+		}
+		authMethods = append(authMethods, authMethod)
+	}
+	if communicatorConfig.SSHPassword != "" {
+		authMethods = append(authMethods,
+			gossh.Password(communicatorConfig.SSHPassword),
+		)
+	}
+
+	hostKeyCallback, err := helpers.SSHHostKeyCallback(settings.SSHHostKeyFingerprint, settings.SSHKnownHostsFile)
+	if err != nil {
+		return
+	}
+
 	clientConfig = &gossh.ClientConfig{
-		User: settings.CommunicatorConfig.SSHUsername,
-		Auth: []gossh.AuthMethod{
-			gossh.Password(settings.CommunicatorConfig.SSHPassword),
-		},
+		User:            communicatorConfig.SSHUsername,
+		Auth:            authMethods,
+		HostKeyCallback: hostKeyCallback,
 	}
 
 	return
@@ -2,11 +2,15 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"regexp"
+	"strings"
 
 	"time"
 
 	"github.com/DimensionDataResearch/packer-plugins-ddcloud/helpers"
+	"github.com/masterzen/winrm"
 	"github.com/mitchellh/packer/common"
 	"github.com/mitchellh/packer/helper/communicator"
 	"github.com/mitchellh/packer/packer"
@@ -30,6 +34,59 @@ type Settings struct {
 	ClientIP             string `mapstructure:"client_ip"`
 	UniquenessKey        string
 	ServerName           string
+
+	// Select the source image using a filter (rather than by name)?
+	SourceImageFilter *SourceImageFilterSettings `mapstructure:"source_image_filter"`
+
+	// Optional suffix (e.g. "-{{timestamp}}") for the target image name; see GetTargetImageName.
+	TargetImageSuffix string `mapstructure:"target_image_suffix"`
+
+	// If the target image already exists, build the new image under a temporary name and then replace it.
+	Force bool `mapstructure:"force"`
+
+	CPUCount          int            `mapstructure:"cpu_count"`
+	CPUCoresPerSocket int            `mapstructure:"cpu_cores_per_socket"`
+	CPUSpeed          string         `mapstructure:"cpu_speed"`
+	MemoryGB          int            `mapstructure:"memory_gb"`
+	Disks             []DiskSettings `mapstructure:"disks"`
+
+	SSHHostKeyFingerprint string `mapstructure:"ssh_host_key_fingerprint"`
+	SSHKnownHostsFile     string `mapstructure:"ssh_known_hosts_file"`
+	SSHTemporaryKeyPair   bool   `mapstructure:"ssh_temporary_key_pair"`
+
+	ClientIPDiscoveryURL    string `mapstructure:"client_ip_discovery_url"`
+	RequireExistingPublicIP bool   `mapstructure:"require_existing_public_ip"`
+
+	FirewallExtraPorts     []int  `mapstructure:"firewall_extra_ports"`
+	FirewallRulePlacement  string `mapstructure:"firewall_rule_placement"`
+	FirewallRuleRelativeTo string `mapstructure:"firewall_rule_relative_to"`
+
+	OnError string `mapstructure:"on_error"`
+}
+
+// DiskSettings represents the settings for a disk attached to the server from which the image will be created.
+type DiskSettings struct {
+	SCSIUnitID int    `mapstructure:"scsi_unit_id"`
+	SizeGB     int    `mapstructure:"size_gb"`
+	Speed      string `mapstructure:"speed"`
+}
+
+// SourceImageFilterSettings represents the criteria used to select the source image when its exact name is not known.
+type SourceImageFilterSettings struct {
+	Name       string `mapstructure:"name"`
+	OSFamily   string `mapstructure:"os_family"`
+	OSType     string `mapstructure:"os_type"`
+	ImageType  string `mapstructure:"image_type"`
+	MostRecent bool   `mapstructure:"most_recent"`
+}
+
+// GetNameRegex compiles the filter's name pattern (returns nil if no name pattern was specified).
+func (filter *SourceImageFilterSettings) GetNameRegex() (*regexp.Regexp, error) {
+	if filter.Name == "" {
+		return nil, nil
+	}
+
+	return regexp.Compile(filter.Name)
 }
 
 var _ helpers.PluginConfig = &Settings{}
@@ -54,6 +111,23 @@ func (settings *Settings) GetMCPPassword() string {
 	return settings.McpPassword
 }
 
+// GetTargetImageName retrieves the name of the customer image to create (TargetImage, followed by TargetImageSuffix if specified).
+func (settings *Settings) GetTargetImageName() string {
+	return settings.TargetImage + settings.TargetImageSuffix
+}
+
+// GetCommunicatorPort retrieves the port used by the configured communicator (if any) to connect to the server.
+func (settings *Settings) GetCommunicatorPort() int {
+	switch settings.CommunicatorConfig.Type {
+	case "ssh":
+		return settings.CommunicatorConfig.SSHPort
+	case "winrm":
+		return settings.CommunicatorConfig.WinRMPort
+	default:
+		return 0
+	}
+}
+
 // Validate determines if the settings is valid.
 func (settings *Settings) Validate() (err error) {
 	if settings.McpRegion == "" {
@@ -98,17 +172,106 @@ func (settings *Settings) Validate() (err error) {
 			fmt.Errorf("'vlan' has not been specified in settings"),
 		)
 	}
-	if settings.SourceImage == "" {
+	if settings.SourceImage == "" && settings.SourceImageFilter == nil {
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("neither 'source_image' nor 'source_image_filter' has been specified in settings"),
+		)
+	} else if settings.SourceImage != "" && settings.SourceImageFilter != nil {
 		err = packer.MultiErrorAppend(err,
-			fmt.Errorf("'source_image' has not been specified in settings"),
+			fmt.Errorf("'source_image' and 'source_image_filter' cannot both be specified in settings"),
 		)
 	}
+	if filter := settings.SourceImageFilter; filter != nil {
+		if filter.Name == "" && filter.OSFamily == "" && filter.OSType == "" {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("'source_image_filter' must specify at least one of 'name', 'os_family', or 'os_type'"),
+			)
+		}
+		if _, regexError := filter.GetNameRegex(); regexError != nil {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("'source_image_filter' has invalid 'name' ('%s'): %s", filter.Name, regexError.Error()),
+			)
+		}
+		filter.ImageType = strings.ToLower(filter.ImageType)
+		switch filter.ImageType {
+		case "", "os", "customer":
+			break
+		default:
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("'source_image_filter' has invalid 'image_type' ('%s'); must be 'os' or 'customer'", filter.ImageType),
+			)
+		}
+	}
 	if settings.TargetImage == "" {
 		err = packer.MultiErrorAppend(err,
 			fmt.Errorf("'target_image' has not been specified in settings"),
 		)
 	}
 
+	// Server hardware.
+	if settings.CPUCount < 0 {
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("'cpu_count' cannot be negative"),
+		)
+	}
+	if settings.CPUCoresPerSocket < 0 {
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("'cpu_cores_per_socket' cannot be negative"),
+		)
+	} else if settings.CPUCoresPerSocket > 0 && settings.CPUCount > 0 && settings.CPUCount%settings.CPUCoresPerSocket != 0 {
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("'cpu_count' (%d) must be a multiple of 'cpu_cores_per_socket' (%d)",
+				settings.CPUCount,
+				settings.CPUCoresPerSocket,
+			),
+		)
+	}
+	if settings.CPUSpeed != "" {
+		settings.CPUSpeed = strings.ToUpper(settings.CPUSpeed)
+
+		if settings.CPUSpeed != "STANDARD" && settings.CPUSpeed != "HIGHPERFORMANCE" {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("'cpu_speed' must be either 'STANDARD' or 'HIGHPERFORMANCE'"),
+			)
+		}
+	}
+	if settings.MemoryGB < 0 {
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("'memory_gb' cannot be negative"),
+		)
+	}
+	scsiUnitIDs := make(map[int]bool)
+	for index := range settings.Disks {
+		disk := &settings.Disks[index]
+
+		if disk.SCSIUnitID < 0 || disk.SCSIUnitID > 15 || disk.SCSIUnitID == 7 {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("disk %d has invalid 'scsi_unit_id' %d (must be between 0 and 15, excluding 7)", index, disk.SCSIUnitID),
+			)
+		} else if scsiUnitIDs[disk.SCSIUnitID] {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("disk %d has duplicate 'scsi_unit_id' %d", index, disk.SCSIUnitID),
+			)
+		}
+		scsiUnitIDs[disk.SCSIUnitID] = true
+
+		if disk.SizeGB < 0 {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("disk %d has negative 'size_gb'", index),
+			)
+		}
+		if disk.Speed == "" {
+			disk.Speed = "STANDARD"
+		} else {
+			disk.Speed = strings.ToUpper(disk.Speed)
+		}
+		if disk.Speed != "STANDARD" && disk.Speed != "HIGHPERFORMANCE" && disk.Speed != "ECONOMY" {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("disk %d has invalid 'speed' '%s' (must be 'STANDARD', 'HIGHPERFORMANCE', or 'ECONOMY')", index, disk.Speed),
+			)
+		}
+	}
+
 	// Communicator defaults.
 	settings.CommunicatorConfig.SSHTimeout = 2 * time.Minute
 	settings.CommunicatorConfig.WinRMTimeout = 2 * time.Minute
@@ -119,8 +282,18 @@ func (settings *Settings) Validate() (err error) {
 			err = packer.MultiErrorAppend(err,
 				fmt.Errorf("'use_private_ipv4' has been specified in settings, but 'client_ip' has not"),
 			)
+		} else if settings.ClientIP != "auto" {
+			clientIP := net.ParseIP(settings.ClientIP)
+			if clientIP == nil || clientIP.To4() == nil {
+				err = packer.MultiErrorAppend(err,
+					fmt.Errorf("'client_ip' must be either a valid IPv4 address or 'auto'"),
+				)
+			}
 		}
 	}
+	if settings.ClientIPDiscoveryURL == "" {
+		settings.ClientIPDiscoveryURL = helpers.DefaultPublicIPDiscoveryURL
+	}
 	if settings.CommunicatorConfig.SSHHost == "" {
 		settings.CommunicatorConfig.SSHHost = settings.ServerName
 	}
@@ -133,11 +306,89 @@ func (settings *Settings) Validate() (err error) {
 	if settings.CommunicatorConfig.SSHPassword == "" {
 		settings.CommunicatorConfig.SSHPassword = settings.InitialAdminPassword
 	}
+	// Firewall rules.
+	for _, port := range settings.FirewallExtraPorts {
+		if port < 1 || port > 65535 {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("'firewall_extra_ports' contains invalid port %d", port),
+			)
+		}
+	}
+	settings.FirewallRulePlacement = strings.ToLower(settings.FirewallRulePlacement)
+	switch settings.FirewallRulePlacement {
+	case "":
+		settings.FirewallRulePlacement = "first"
+	case "first":
+		break
+	case "before", "after":
+		if settings.FirewallRuleRelativeTo == "" {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("'firewall_rule_placement' is '%s', but 'firewall_rule_relative_to' has not been specified", settings.FirewallRulePlacement),
+			)
+		}
+	default:
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("'firewall_rule_placement' must be 'first', 'before', or 'after'"),
+		)
+	}
+	if settings.FirewallRulePlacement == "first" && settings.FirewallRuleRelativeTo != "" {
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("'firewall_rule_relative_to' has been specified, but 'firewall_rule_placement' is not 'before' or 'after'"),
+		)
+	}
+
+	settings.OnError = strings.ToLower(settings.OnError)
+	switch settings.OnError {
+	case "":
+		settings.OnError = "cleanup"
+	case "cleanup", "abort", "ask":
+		break
+	default:
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("'on_error' must be 'cleanup', 'abort', or 'ask'"),
+		)
+	}
+
+	if settings.CommunicatorConfig.SSHPrivateKey != "" {
+		if _, statErr := os.Stat(settings.CommunicatorConfig.SSHPrivateKey); statErr != nil {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("'ssh_private_key_file' ('%s') cannot be accessed: %s", settings.CommunicatorConfig.SSHPrivateKey, statErr.Error()),
+			)
+		}
+	}
+	if settings.SSHKnownHostsFile != "" {
+		if _, statErr := os.Stat(settings.SSHKnownHostsFile); statErr != nil {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("'ssh_known_hosts_file' ('%s') cannot be accessed: %s", settings.SSHKnownHostsFile, statErr.Error()),
+			)
+		}
+	}
+	if settings.SSHTemporaryKeyPair {
+		if settings.CommunicatorConfig.Type != "ssh" {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("'ssh_temporary_key_pair' has been specified in settings, but the communicator is not 'ssh'"),
+			)
+		}
+		if settings.CommunicatorConfig.SSHPassword == "" {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("'ssh_temporary_key_pair' has been specified in settings, but neither 'ssh_password' nor 'initial_admin_password' has been specified (required to install the temporary key)"),
+			)
+		}
+	}
 	if settings.CommunicatorConfig.WinRMHost == "" {
 		settings.CommunicatorConfig.WinRMHost = settings.ServerName
 	}
 	if settings.CommunicatorConfig.WinRMPort == 0 {
-		settings.CommunicatorConfig.WinRMPort = 5895
+		if settings.CommunicatorConfig.WinRMUseSSL {
+			settings.CommunicatorConfig.WinRMPort = 5986
+		} else {
+			settings.CommunicatorConfig.WinRMPort = 5985
+		}
+	}
+	if settings.CommunicatorConfig.WinRMUseNTLM {
+		settings.CommunicatorConfig.WinRMTransportDecorator = func() winrm.Transporter {
+			return &winrm.ClientNTLM{}
+		}
 	}
 	if settings.CommunicatorConfig.WinRMUser == "" {
 		settings.CommunicatorConfig.WinRMUser = "Administrator"
@@ -17,6 +17,11 @@ func main() {
 
 		return
 	}
+	if len(os.Args) >= 2 && os.Args[1] == "sweep" {
+		os.Exit(
+			runSweep(os.Args[2:]),
+		)
+	}
 
 	server, err := plugin.Server()
 	if err != nil {
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/DimensionDataResearch/go-dd-cloud-compute/compute"
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/helpers"
+)
+
+// Build resources are named using the uniqueness key generated by createUniquenessKey.
+var (
+	buildServerNamePattern   = regexp.MustCompile(`^packer-build-([0-9a-f]{10})$`)
+	buildFirewallRulePattern = regexp.MustCompile(`^packer\.([0-9a-f]{10})\.inbound(\.\d+)?$`)
+)
+
+// orphanedBuildResources represents the orphaned resources from a single build.
+//
+// NAT rules whose internal addresses are not bound to any server cannot be attributed to a specific build, so they are grouped together (with an empty UniquenessKey).
+type orphanedBuildResources struct {
+	UniquenessKey    string
+	Server           *compute.Server
+	NATRules         []compute.NATRule
+	FirewallRules    []compute.FirewallRule
+	PublicIPBlockIDs []string
+}
+
+// runSweep finds (and optionally destroys) build resources left behind by crashed or killed builds.
+//
+// Returns the process exit code.
+func runSweep(args []string) int {
+	flags := flag.NewFlagSet("sweep", flag.ContinueOnError)
+	region := flags.String("region", os.Getenv("MCP_REGION"), "The CloudControl region code (e.g. AU, NA, EU, etc).")
+	datacenterID := flags.String("datacenter", "", "The Id of the datacenter containing the network domain.")
+	networkDomainName := flags.String("networkdomain", "", "The name of the network domain to sweep.")
+	minAge := flags.Duration("min-age", 6*time.Hour, "Only sweep build servers (and their firewall / NAT rules) that were created at least this long ago.")
+	destroy := flags.Bool("destroy", false, "Destroy the orphaned resources (otherwise, only list them).")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+
+	if *region == "" || *datacenterID == "" || *networkDomainName == "" {
+		fmt.Fprintln(os.Stderr, "The -region (or MCP_REGION environment variable), -datacenter, and -networkdomain arguments are required.")
+		flags.Usage()
+
+		return 2
+	}
+
+	mcpUser := os.Getenv("MCP_USER")
+	mcpPassword := os.Getenv("MCP_PASSWORD")
+	if mcpUser == "" || mcpPassword == "" {
+		fmt.Fprintln(os.Stderr, "The MCP_USER and MCP_PASSWORD environment variables must be set.")
+
+		return 2
+	}
+
+	client := compute.NewClient(*region, mcpUser, mcpPassword)
+	if os.Getenv("MCP_EXTENDED_LOGGING") != "" {
+		client.EnableExtendedLogging()
+	}
+
+	networkDomain, err := client.GetNetworkDomainByName(*networkDomainName, *datacenterID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+
+		return 1
+	}
+	if networkDomain == nil {
+		fmt.Fprintf(os.Stderr, "Unable to find network domain '%s' in datacenter '%s'.\n", *networkDomainName, *datacenterID)
+
+		return 1
+	}
+
+	orphans, err := findOrphanedBuildResources(client, networkDomain.ID, *minAge)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+
+		return 1
+	}
+	if len(orphans) == 0 {
+		fmt.Printf("No orphaned build resources found in network domain '%s' ('%s').\n", networkDomain.Name, networkDomain.ID)
+
+		return 0
+	}
+
+	for _, orphan := range orphans {
+		describeOrphanedBuildResources(orphan)
+	}
+
+	if !*destroy {
+		fmt.Println("Dry run; nothing has been destroyed (specify -destroy to destroy these resources).")
+
+		return 0
+	}
+
+	exitCode := 0
+	for _, orphan := range orphans {
+		err = destroyOrphanedBuildResources(client, networkDomain.ID, orphan)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to destroy resources for build '%s': %s\n", orphan.UniquenessKey, err.Error())
+
+			exitCode = 1
+		}
+	}
+
+	return exitCode
+}
+
+// Find orphaned build resources in the specified network domain (see classifyOrphanedBuildResources), together with the public IP blocks used by their NAT rules.
+func findOrphanedBuildResources(client *compute.Client, networkDomainID string, minAge time.Duration) (orphans []*orphanedBuildResources, err error) {
+	// Rules are listed before servers; since a build creates its server before its rules (and destroys its rules before its server),
+	// any rule that belongs to a running build is guaranteed to have its server in the server list.
+	var firewallRules []compute.FirewallRule
+	page := compute.DefaultPaging()
+	for {
+		var firewallRulesPage *compute.FirewallRules
+		firewallRulesPage, err = client.ListFirewallRules(networkDomainID, page)
+		if err != nil {
+			return
+		}
+		if firewallRulesPage.IsEmpty() {
+			break // We're done
+		}
+		firewallRules = append(firewallRules, firewallRulesPage.Rules...)
+
+		page.Next()
+	}
+
+	var natRules []compute.NATRule
+	page = compute.DefaultPaging()
+	for {
+		var natRulesPage *compute.NATRules
+		natRulesPage, err = client.ListNATRules(networkDomainID, page)
+		if err != nil {
+			return
+		}
+		if natRulesPage.IsEmpty() {
+			break // We're done
+		}
+		natRules = append(natRules, natRulesPage.Rules...)
+
+		page.Next()
+	}
+
+	var servers []compute.Server
+	page = compute.DefaultPaging()
+	for {
+		var serversPage *compute.Servers
+		serversPage, err = client.ListServersInNetworkDomain(networkDomainID, page)
+		if err != nil {
+			return
+		}
+		if serversPage.IsEmpty() {
+			break // We're done
+		}
+		servers = append(servers, serversPage.Items...)
+
+		page.Next()
+	}
+
+	orphans, err = classifyOrphanedBuildResources(servers, firewallRules, natRules, minAge, time.Now())
+	if err != nil {
+		return
+	}
+
+	// Find the public IP blocks used by orphaned NAT rules, so they can be released once they are no longer in use.
+	publicIPBlockIDsByAddress := make(map[string]string)
+	page = compute.DefaultPaging()
+	for {
+		var reservedIPs *compute.ReservedPublicIPs
+		reservedIPs, err = client.ListReservedPublicIPAddresses(networkDomainID, page)
+		if err != nil {
+			return
+		}
+		if reservedIPs.IsEmpty() {
+			break // We're done
+		}
+
+		for _, reservedIP := range reservedIPs.Items {
+			publicIPBlockIDsByAddress[reservedIP.Address] = reservedIP.IPBlockID
+		}
+
+		page.Next()
+	}
+	for _, orphan := range orphans {
+		for _, natRule := range orphan.NATRules {
+			publicIPBlockID, ok := publicIPBlockIDsByAddress[natRule.ExternalIPAddress]
+			if ok && !containsString(orphan.PublicIPBlockIDs, publicIPBlockID) {
+				orphan.PublicIPBlockIDs = append(orphan.PublicIPBlockIDs, publicIPBlockID)
+			}
+		}
+	}
+
+	return
+}
+
+// Classify build resources, returning those that are orphaned (ordered by uniqueness key).
+//
+// A build server is orphaned if it was created at least minAge ago.
+// A build firewall rule is orphaned if its server is orphaned, or no longer exists (regardless of the rule's age).
+// A NAT rule is orphaned if its internal address belongs to an orphaned build server, or is not bound to any server in the network domain.
+func classifyOrphanedBuildResources(servers []compute.Server, firewallRules []compute.FirewallRule, natRules []compute.NATRule, minAge time.Duration, now time.Time) (orphans []*orphanedBuildResources, err error) {
+	orphansByKey := make(map[string]*orphanedBuildResources)
+	orphanKeysByPrivateIPv4 := make(map[string]string)
+	boundPrivateIPv4s := make(map[string]bool)
+	activeKeys := make(map[string]bool)
+
+	for index := range servers {
+		server := &servers[index]
+
+		serverPrivateIPv4s := getServerPrivateIPv4Addresses(server)
+		for _, privateIPv4 := range serverPrivateIPv4s {
+			boundPrivateIPv4s[privateIPv4] = true
+		}
+
+		match := buildServerNamePattern.FindStringSubmatch(server.Name)
+		if match == nil {
+			continue
+		}
+		uniquenessKey := match[1]
+
+		var createTime time.Time
+		createTime, err = time.Parse(time.RFC3339, server.CreateTime)
+		if err != nil {
+			err = fmt.Errorf("Unable to parse creation time '%s' for server '%s' ('%s'): %s", server.CreateTime, server.Name, server.ID, err.Error())
+
+			return
+		}
+		if now.Sub(createTime) < minAge {
+			activeKeys[uniquenessKey] = true
+
+			continue
+		}
+
+		orphansByKey[uniquenessKey] = &orphanedBuildResources{
+			UniquenessKey: uniquenessKey,
+			Server:        server,
+		}
+		for _, privateIPv4 := range serverPrivateIPv4s {
+			orphanKeysByPrivateIPv4[privateIPv4] = uniquenessKey
+		}
+	}
+
+	getOrphan := func(uniquenessKey string) *orphanedBuildResources {
+		orphan := orphansByKey[uniquenessKey]
+		if orphan == nil {
+			orphan = &orphanedBuildResources{
+				UniquenessKey: uniquenessKey,
+			}
+			orphansByKey[uniquenessKey] = orphan
+		}
+
+		return orphan
+	}
+
+	for _, firewallRule := range firewallRules {
+		match := buildFirewallRulePattern.FindStringSubmatch(firewallRule.Name)
+		if match == nil {
+			continue
+		}
+		uniquenessKey := match[1]
+		if activeKeys[uniquenessKey] {
+			continue // Server exists, and is not old enough to be orphaned.
+		}
+
+		orphan := getOrphan(uniquenessKey)
+		orphan.FirewallRules = append(orphan.FirewallRules, firewallRule)
+	}
+
+	for _, natRule := range natRules {
+		if uniquenessKey, ok := orphanKeysByPrivateIPv4[natRule.InternalIPAddress]; ok {
+			orphan := getOrphan(uniquenessKey)
+			orphan.NATRules = append(orphan.NATRules, natRule)
+
+			continue
+		}
+		if boundPrivateIPv4s[natRule.InternalIPAddress] {
+			continue // Belongs to some other server.
+		}
+
+		// Most likely left behind by a build whose server has since been deleted.
+		orphan := getOrphan("")
+		orphan.NATRules = append(orphan.NATRules, natRule)
+	}
+
+	uniquenessKeys := make([]string, 0, len(orphansByKey))
+	for uniquenessKey := range orphansByKey {
+		uniquenessKeys = append(uniquenessKeys, uniquenessKey)
+	}
+	sort.Strings(uniquenessKeys)
+	for _, uniquenessKey := range uniquenessKeys {
+		orphans = append(orphans, orphansByKey[uniquenessKey])
+	}
+
+	return
+}
+
+// Get the private IPv4 addresses of all of a server's network adapters.
+func getServerPrivateIPv4Addresses(server *compute.Server) (privateIPv4s []string) {
+	if server.Network.PrimaryAdapter.PrivateIPv4Address != nil {
+		privateIPv4s = append(privateIPv4s, *server.Network.PrimaryAdapter.PrivateIPv4Address)
+	}
+	for _, adapter := range server.Network.AdditionalNetworkAdapters {
+		if adapter.PrivateIPv4Address != nil {
+			privateIPv4s = append(privateIPv4s, *adapter.PrivateIPv4Address)
+		}
+	}
+
+	return
+}
+
+func containsString(values []string, value string) bool {
+	for _, existingValue := range values {
+		if existingValue == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Display the resources that comprise an orphaned build.
+func describeOrphanedBuildResources(orphan *orphanedBuildResources) {
+	if orphan.UniquenessKey == "" {
+		fmt.Println("NAT rules whose internal addresses are not bound to any server:")
+	} else {
+		fmt.Printf("Build '%s':\n", orphan.UniquenessKey)
+	}
+
+	for _, firewallRule := range orphan.FirewallRules {
+		fmt.Printf("- Firewall rule '%s' ('%s')\n", firewallRule.Name, firewallRule.ID)
+	}
+	for _, natRule := range orphan.NATRules {
+		fmt.Printf("- NAT rule '%s' ('%s' -> '%s')\n", natRule.ID, natRule.ExternalIPAddress, natRule.InternalIPAddress)
+	}
+	for _, publicIPBlockID := range orphan.PublicIPBlockIDs {
+		fmt.Printf("- Public IP block '%s' (released if no longer in use)\n", publicIPBlockID)
+	}
+	if orphan.Server != nil {
+		fmt.Printf("- Server '%s' ('%s'), created %s\n", orphan.Server.Name, orphan.Server.ID, orphan.Server.CreateTime)
+	}
+}
+
+// Destroy the resources that comprise an orphaned build (firewall rules, then NAT rules and any public IP blocks they no longer need, then the server).
+func destroyOrphanedBuildResources(client *compute.Client, networkDomainID string, orphan *orphanedBuildResources) error {
+	for _, firewallRule := range orphan.FirewallRules {
+		fmt.Printf("Destroying firewall rule '%s' ('%s')...\n", firewallRule.Name, firewallRule.ID)
+
+		err := client.DeleteFirewallRule(firewallRule.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, natRule := range orphan.NATRules {
+		fmt.Printf("Destroying NAT rule '%s' ('%s' -> '%s')...\n", natRule.ID, natRule.ExternalIPAddress, natRule.InternalIPAddress)
+
+		err := client.DeleteNATRule(natRule.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, publicIPBlockID := range orphan.PublicIPBlockIDs {
+		inUse, err := helpers.IsPublicIPBlockInUse(client, networkDomainID, publicIPBlockID)
+		if err != nil {
+			return err
+		}
+		if inUse {
+			fmt.Printf("Not releasing public IP block '%s' (one or more of its addresses are still in use).\n", publicIPBlockID)
+
+			continue
+		}
+
+		fmt.Printf("Releasing public IP block '%s'...\n", publicIPBlockID)
+
+		err = client.RemovePublicIPBlock(publicIPBlockID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if orphan.Server == nil {
+		return nil
+	}
+
+	server, err := client.GetServer(orphan.Server.ID)
+	if err != nil {
+		return err
+	}
+	if server == nil {
+		return nil // Already deleted.
+	}
+
+	if server.Started {
+		fmt.Printf("Shutting down server '%s' ('%s')...\n", server.Name, server.ID)
+
+		err = client.ShutdownServer(server.ID)
+		if err != nil {
+			return err
+		}
+
+		_, err = client.WaitForChange(compute.ResourceTypeServer, server.ID, "Shut down", 5*time.Minute)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Destroying server '%s' ('%s')...\n", server.Name, server.ID)
+
+	err = client.DeleteServer(server.ID)
+	if err != nil {
+		return err
+	}
+
+	return client.WaitForDelete(compute.ResourceTypeServer, server.ID, 20*time.Minute)
+}
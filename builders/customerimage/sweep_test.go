@@ -0,0 +1,149 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DimensionDataResearch/go-dd-cloud-compute/compute"
+)
+
+func TestBuildServerNamePattern(test *testing.T) {
+	testCases := []struct {
+		name        string
+		expectedKey string
+	}{
+		{"packer-build-0123456789", "0123456789"},
+		{"packer-build-abcdef0123", "abcdef0123"},
+		{"packer-build-ABCDEF0123", ""},
+		{"packer-build-012345678", ""},
+		{"packer-build-01234567890", ""},
+		{"my-packer-build-0123456789", ""},
+		{"packer-build-0123456789-copy", ""},
+	}
+
+	for _, testCase := range testCases {
+		actualKey := ""
+		match := buildServerNamePattern.FindStringSubmatch(testCase.name)
+		if match != nil {
+			actualKey = match[1]
+		}
+		if actualKey != testCase.expectedKey {
+			test.Errorf("'%s': key is '%s' (expected '%s')", testCase.name, actualKey, testCase.expectedKey)
+		}
+	}
+}
+
+func TestBuildFirewallRulePattern(test *testing.T) {
+	testCases := []struct {
+		name        string
+		expectedKey string
+	}{
+		{"packer.0123456789.inbound", "0123456789"},
+		{"packer.0123456789.inbound.2", "0123456789"},
+		{"packer.0123456789.inbound.", ""},
+		{"packer.0123456789.outbound", ""},
+		{"packer.012345678.inbound", ""},
+		{"packer-0123456789-inbound", ""},
+		{"my.packer.0123456789.inbound", ""},
+	}
+
+	for _, testCase := range testCases {
+		actualKey := ""
+		match := buildFirewallRulePattern.FindStringSubmatch(testCase.name)
+		if match != nil {
+			actualKey = match[1]
+		}
+		if actualKey != testCase.expectedKey {
+			test.Errorf("'%s': key is '%s' (expected '%s')", testCase.name, actualKey, testCase.expectedKey)
+		}
+	}
+}
+
+func TestClassifyOrphanedBuildResources(test *testing.T) {
+	now := time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+	minAge := 6 * time.Hour
+
+	servers := []compute.Server{
+		newTestServer("packer-build-aaaaaaaaaa", now.Add(-7*time.Hour), "10.0.0.10"), // Old build server.
+		newTestServer("packer-build-bbbbbbbbbb", now.Add(-1*time.Hour), "10.0.0.11"), // Running build server.
+		newTestServer("web-server", now.Add(-100*time.Hour), "10.0.0.12"),            // Not a build server.
+	}
+	servers[2].Network.AdditionalNetworkAdapters = []compute.VirtualMachineNetworkAdapter{
+		{PrivateIPv4Address: stringPtr("10.0.1.12")},
+	}
+
+	firewallRules := []compute.FirewallRule{
+		{ID: "fw-a", Name: "packer.aaaaaaaaaa.inbound"},
+		{ID: "fw-b", Name: "packer.bbbbbbbbbb.inbound"},
+		{ID: "fw-c", Name: "packer.cccccccccc.inbound"}, // Server no longer exists.
+		{ID: "fw-c2", Name: "packer.cccccccccc.inbound.2"},
+		{ID: "fw-web", Name: "web.inbound"},
+	}
+
+	natRules := []compute.NATRule{
+		{ID: "nat-a", InternalIPAddress: "10.0.0.10", ExternalIPAddress: "1.2.3.10"},
+		{ID: "nat-b", InternalIPAddress: "10.0.0.11", ExternalIPAddress: "1.2.3.11"},
+		{ID: "nat-web", InternalIPAddress: "10.0.0.12", ExternalIPAddress: "1.2.3.12"},
+		{ID: "nat-web2", InternalIPAddress: "10.0.1.12", ExternalIPAddress: "1.2.3.13"},
+		{ID: "nat-unbound", InternalIPAddress: "10.0.0.99", ExternalIPAddress: "1.2.3.99"}, // Server no longer exists.
+	}
+
+	orphans, err := classifyOrphanedBuildResources(servers, firewallRules, natRules, minAge, now)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expectedOrphans := []*orphanedBuildResources{
+		{
+			UniquenessKey: "",
+			NATRules:      []compute.NATRule{natRules[4]},
+		},
+		{
+			UniquenessKey: "aaaaaaaaaa",
+			Server:        &servers[0],
+			NATRules:      []compute.NATRule{natRules[0]},
+			FirewallRules: []compute.FirewallRule{firewallRules[0]},
+		},
+		{
+			UniquenessKey: "cccccccccc",
+			FirewallRules: []compute.FirewallRule{firewallRules[2], firewallRules[3]},
+		},
+	}
+	if !reflect.DeepEqual(orphans, expectedOrphans) {
+		test.Errorf("orphans are:")
+		for _, orphan := range orphans {
+			test.Errorf("  %#v", orphan)
+		}
+		test.Errorf("expected:")
+		for _, orphan := range expectedOrphans {
+			test.Errorf("  %#v", orphan)
+		}
+	}
+}
+
+func TestClassifyOrphanedBuildResourcesInvalidCreateTime(test *testing.T) {
+	servers := []compute.Server{
+		{ID: "server-1", Name: "packer-build-aaaaaaaaaa", CreateTime: "yesterday"},
+	}
+
+	_, err := classifyOrphanedBuildResources(servers, nil, nil, time.Hour, time.Now())
+	if err == nil {
+		test.Fatal("expected an error")
+	}
+}
+
+func newTestServer(name string, createTime time.Time, privateIPv4Address string) compute.Server {
+	server := compute.Server{
+		ID:         name + "-id",
+		Name:       name,
+		CreateTime: createTime.Format(time.RFC3339),
+	}
+	server.Network.PrimaryAdapter.PrivateIPv4Address = stringPtr(privateIPv4Address)
+
+	return server
+}
+
+func stringPtr(value string) *string {
+	return &value
+}
@@ -0,0 +1,505 @@
+package helpers
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/textproto"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FTPSProgressHandler is a function that receives progress updates for an FTPS transfer.
+type FTPSProgressHandler func(transferredBytes int64, totalBytes int64)
+
+// FTPSClient is a minimal client for explicit FTPS (FTP with "AUTH TLS"), as used by CloudControl's FTPS hosts.
+type FTPSClient struct {
+	// The FTPS host name.
+	HostName string
+
+	hostAddress string
+	tlsConfig   *tls.Config
+	control     *textproto.Conn
+}
+
+// CreateFTPSTLSConfig creates a TLS configuration for connecting to the specified FTPS host.
+//
+// If caCertFile is specified, the host's certificate must be issued by a CA from that (PEM-encoded) file.
+// If skipVerify is true, the host's certificate will not be verified at all.
+func CreateFTPSTLSConfig(hostName string, caCertFile string, skipVerify bool) (tlsConfig *tls.Config, err error) {
+	tlsConfig = &tls.Config{
+		ServerName:         hostName,
+		InsecureSkipVerify: skipVerify,
+
+		// Many FTPS servers require the data connection to resume the control connection's TLS session.
+		ClientSessionCache: tls.NewLRUClientSessionCache(0),
+	}
+
+	if caCertFile != "" {
+		var caCertPEM []byte
+		caCertPEM, err = ioutil.ReadFile(caCertFile)
+		if err != nil {
+			return
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCertPEM) {
+			err = fmt.Errorf("No valid certificates found in CA certificate file '%s'", caCertFile)
+		}
+	}
+
+	return
+}
+
+// ConnectFTPS connects and logs into the specified FTPS host.
+func ConnectFTPS(hostName string, user string, password string, tlsConfig *tls.Config) (client *FTPSClient, err error) {
+	client = &FTPSClient{
+		HostName:    hostName,
+		hostAddress: net.JoinHostPort(hostName, "21"),
+		tlsConfig:   tlsConfig,
+	}
+
+	var connection net.Conn
+	connection, err = net.DialTimeout("tcp", client.hostAddress, 30*time.Second)
+	if err != nil {
+		err = fmt.Errorf("Unable to connect to FTPS host '%s': %s", hostName, err.Error())
+
+		return
+	}
+
+	client.control = textproto.NewConn(connection)
+	_, _, err = client.control.ReadResponse(220)
+	if err != nil {
+		client.control.Close()
+		err = fmt.Errorf("Unexpected greeting from FTPS host '%s': %s", hostName, err.Error())
+
+		return
+	}
+
+	// Switch control connection to TLS.
+	_, err = client.command(234, "AUTH TLS")
+	if err != nil {
+		client.control.Close()
+
+		return
+	}
+	tlsConnection := tls.Client(connection, tlsConfig)
+	err = tlsConnection.Handshake()
+	if err != nil {
+		connection.Close()
+		err = fmt.Errorf("TLS handshake with FTPS host '%s' failed: %s", hostName, err.Error())
+
+		return
+	}
+	client.control = textproto.NewConn(tlsConnection)
+
+	// Note that the password is never logged.
+	log.Printf("FTPS: logging into '%s' as '%s'.", hostName, user)
+	_, err = client.command(331, "USER %s", user)
+	if err != nil {
+		client.Close()
+
+		return
+	}
+	_, err = client.command(230, "PASS %s", password)
+	if err != nil {
+		client.Close()
+		err = fmt.Errorf("Failed to log into FTPS host '%s' as '%s'", hostName, user)
+
+		return
+	}
+
+	// Encrypt data connections.
+	for _, setupCommand := range []string{"PBSZ 0", "PROT P", "TYPE I"} {
+		_, err = client.command(200, "%s", setupCommand)
+		if err != nil {
+			client.Close()
+
+			return
+		}
+	}
+
+	return
+}
+
+// Close logs out and disconnects from the FTPS host.
+func (client *FTPSClient) Close() error {
+	if client.control == nil {
+		return nil
+	}
+
+	client.command(221, "QUIT")
+	err := client.control.Close()
+	client.control = nil
+
+	return err
+}
+
+// Upload uploads a local file to the FTPS host.
+//
+// If resume is true and a partial copy of the file already exists on the host, only the remaining data is uploaded.
+// The existing remote file is first downloaded and compared with the local file, and is only resumed if its content matches the start of the local file;
+// otherwise (e.g. if it is a stale copy of a different file with the same name), the file is uploaded from the start.
+// If digest is not nil, all of the file's data (including any previously-uploaded portion) is written to it.
+//
+// Returns the offset from which the upload was resumed (0 if the whole file was uploaded).
+func (client *FTPSClient) Upload(localFile string, remoteFileName string, resume bool, digest hash.Hash, progress FTPSProgressHandler) (resumedFrom int64, err error) {
+	file, err := os.Open(localFile)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return
+	}
+	totalBytes := fileInfo.Size()
+
+	if resume {
+		resumedFrom = client.getResumeOffset(remoteFileName, file, totalBytes)
+
+		_, err = file.Seek(0, io.SeekStart)
+		if err != nil {
+			return
+		}
+	}
+
+	// Data that has already been uploaded (and verified) still contributes to the digest.
+	var source io.Reader = file
+	if digest != nil {
+		_, err = io.CopyN(digest, file, resumedFrom)
+		if err != nil {
+			return
+		}
+		source = io.TeeReader(file, digest)
+	} else {
+		_, err = file.Seek(resumedFrom, io.SeekStart)
+		if err != nil {
+			return
+		}
+	}
+
+	if resumedFrom == totalBytes {
+		log.Printf("FTPS: '%s' has already been completely uploaded to '%s'.", remoteFileName, client.HostName)
+
+		if digest != nil {
+			_, err = io.Copy(digest, file)
+		}
+
+		return
+	}
+
+	dataConnection, err := client.openDataConnection(resumedFrom, "STOR %s", remoteFileName)
+	if restartErr, ok := err.(*ftpsRestartError); ok {
+		log.Printf("FTPS: host '%s' does not support resuming uploads (%s); uploading '%s' from the start.", client.HostName, restartErr.Error(), remoteFileName)
+
+		if digest != nil {
+			digest.Reset()
+		}
+
+		return client.Upload(localFile, remoteFileName, false, digest, progress)
+	}
+	if err != nil {
+		return
+	}
+
+	progressSource := &progressReader{
+		reader:      source,
+		transferred: resumedFrom,
+		total:       totalBytes,
+		progress:    progress,
+	}
+	_, err = io.Copy(dataConnection, progressSource)
+	closeErr := dataConnection.Close()
+	if err != nil {
+		err = fmt.Errorf("Failed to upload '%s' to FTPS host '%s': %s", remoteFileName, client.HostName, err.Error())
+
+		return
+	}
+	if closeErr != nil {
+		err = fmt.Errorf("Failed to upload '%s' to FTPS host '%s': %s", remoteFileName, client.HostName, closeErr.Error())
+
+		return
+	}
+
+	_, _, err = client.control.ReadResponse(226)
+	if err != nil {
+		err = fmt.Errorf("Failed to upload '%s' to FTPS host '%s': %s", remoteFileName, client.HostName, err.Error())
+
+		return
+	}
+
+	// Verify the length of the uploaded file.
+	uploadedBytes, err := client.Size(remoteFileName)
+	if err != nil {
+		return
+	}
+	if uploadedBytes != totalBytes {
+		err = fmt.Errorf("Uploaded file '%s' on FTPS host '%s' is %d bytes (expected %d bytes)", remoteFileName, client.HostName, uploadedBytes, totalBytes)
+	}
+
+	return
+}
+
+// Determine the offset from which an upload can be resumed (based on any partially-uploaded copy of the file).
+//
+// The remote file's size alone is not enough to go on, so its content must also match the start of the local file.
+func (client *FTPSClient) getResumeOffset(remoteFileName string, localFile io.Reader, totalBytes int64) int64 {
+	remoteBytes, err := client.Size(remoteFileName)
+	if err != nil {
+		// Most likely, the file does not exist yet.
+		log.Printf("FTPS: unable to determine size of '%s' on '%s' (%s); it will be uploaded from the start.", remoteFileName, client.HostName, err.Error())
+
+		return 0
+	}
+	if remoteBytes > totalBytes {
+		log.Printf("FTPS: '%s' on '%s' is larger than the local file; it will be uploaded from the start.", remoteFileName, client.HostName)
+
+		return 0
+	}
+	if remoteBytes == 0 {
+		return 0
+	}
+
+	matches, err := client.remoteFileMatches(remoteFileName, localFile)
+	if err != nil {
+		log.Printf("FTPS: unable to verify content of '%s' on '%s' (%s); it will be uploaded from the start.", remoteFileName, client.HostName, err.Error())
+
+		return 0
+	}
+	if !matches {
+		log.Printf("FTPS: content of '%s' on '%s' does not match the local file; it will be uploaded from the start.", remoteFileName, client.HostName)
+
+		return 0
+	}
+
+	return remoteBytes
+}
+
+// Download a file from the FTPS host, and determine whether its content matches the start of the specified local data.
+func (client *FTPSClient) remoteFileMatches(remoteFileName string, localData io.Reader) (matches bool, err error) {
+	dataConnection, err := client.openDataConnection(0, "RETR %s", remoteFileName)
+	if err != nil {
+		return
+	}
+
+	// Always consume the entire transfer, so that the control connection remains in a known state.
+	comparer := &prefixComparer{
+		expected: localData,
+		matches:  true,
+	}
+	_, err = io.Copy(comparer, dataConnection)
+	dataConnection.Close()
+
+	// The transfer's final status must be read from the control connection, even if the transfer failed.
+	_, _, responseErr := client.control.ReadResponse(226)
+	if err == nil {
+		err = responseErr
+	}
+	if err != nil {
+		err = fmt.Errorf("Failed to download '%s' from FTPS host '%s': %s", remoteFileName, client.HostName, err.Error())
+
+		return
+	}
+
+	matches = comparer.matches
+
+	return
+}
+
+// Download downloads a file from the FTPS host to a local file.
+func (client *FTPSClient) Download(remoteFileName string, localFile string, progress FTPSProgressHandler) error {
+	totalBytes, err := client.Size(remoteFileName)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(localFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	dataConnection, err := client.openDataConnection(0, "RETR %s", remoteFileName)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, newProgressReader(dataConnection, totalBytes, progress))
+	dataConnection.Close()
+	if err != nil {
+		return fmt.Errorf("Failed to download '%s' from FTPS host '%s': %s", remoteFileName, client.HostName, err.Error())
+	}
+
+	_, _, err = client.control.ReadResponse(226)
+	if err != nil {
+		return fmt.Errorf("Failed to download '%s' from FTPS host '%s': %s", remoteFileName, client.HostName, err.Error())
+	}
+
+	return nil
+}
+
+// Delete deletes a file from the FTPS host.
+func (client *FTPSClient) Delete(remoteFileName string) error {
+	_, err := client.command(250, "DELE %s", remoteFileName)
+
+	return err
+}
+
+// Size retrieves the size (in bytes) of a file on the FTPS host.
+func (client *FTPSClient) Size(remoteFileName string) (size int64, err error) {
+	message, err := client.command(213, "SIZE %s", remoteFileName)
+	if err != nil {
+		return
+	}
+
+	size, err = strconv.ParseInt(strings.TrimSpace(message), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("Invalid size '%s' returned by FTPS host '%s' for '%s'", message, client.HostName, remoteFileName)
+	}
+
+	return
+}
+
+// Execute a command on the control connection, and read the response (which must have the specified status code).
+func (client *FTPSClient) command(expectCode int, format string, args ...interface{}) (message string, err error) {
+	commandLine := fmt.Sprintf(format, args...)
+	_, err = client.control.Cmd("%s", commandLine)
+	if err != nil {
+		return
+	}
+
+	_, message, err = client.control.ReadResponse(expectCode)
+	if err != nil {
+		// Don't leak credentials in error messages.
+		commandName := strings.SplitN(commandLine, " ", 2)[0]
+		err = fmt.Errorf("FTPS host '%s' rejected %s command: %s", client.HostName, commandName, err.Error())
+	}
+
+	return
+}
+
+var epsvResponsePattern = regexp.MustCompile(`\(\|\|\|(\d+)\|\)`)
+
+// ftpsRestartError indicates that the FTPS host rejected a restart offset (REST command).
+type ftpsRestartError struct {
+	error
+}
+
+// Open a (TLS-encrypted) passive-mode data connection for the specified transfer command.
+//
+// If restartOffset is greater than 0, the transfer is restarted from that offset.
+// REST must immediately precede the transfer command (EPSV would reset it), so it is sent once the data connection has been established.
+func (client *FTPSClient) openDataConnection(restartOffset int64, format string, args ...interface{}) (dataConnection net.Conn, err error) {
+	message, err := client.command(229, "EPSV")
+	if err != nil {
+		return
+	}
+	match := epsvResponsePattern.FindStringSubmatch(message)
+	if match == nil {
+		err = fmt.Errorf("Invalid EPSV response from FTPS host '%s': '%s'", client.HostName, message)
+
+		return
+	}
+
+	// Always connect to the control connection's host (the server may be behind NAT).
+	connection, err := net.DialTimeout("tcp", net.JoinHostPort(client.HostName, match[1]), 30*time.Second)
+	if err != nil {
+		err = fmt.Errorf("Unable to open data connection to FTPS host '%s': %s", client.HostName, err.Error())
+
+		return
+	}
+
+	if restartOffset > 0 {
+		_, err = client.command(350, "REST %d", restartOffset)
+		if err != nil {
+			connection.Close()
+			err = &ftpsRestartError{err}
+
+			return
+		}
+	}
+
+	_, err = client.control.Cmd(format, args...)
+	if err != nil {
+		connection.Close()
+
+		return
+	}
+	code, message, err := client.control.ReadResponse(1)
+	if err != nil {
+		connection.Close()
+		err = fmt.Errorf("FTPS host '%s' rejected transfer (%d %s): %s", client.HostName, code, message, err.Error())
+
+		return
+	}
+
+	dataConnection = tls.Client(connection, client.tlsConfig)
+
+	return
+}
+
+// prefixComparer is an io.Writer that determines whether the data written to it matches the data read from another io.Reader.
+type prefixComparer struct {
+	expected io.Reader
+	matches  bool
+	buffer   []byte
+}
+
+func (comparer *prefixComparer) Write(data []byte) (count int, err error) {
+	count = len(data)
+	if !comparer.matches {
+		return // Already known not to match; just consume the remaining data.
+	}
+
+	if len(comparer.buffer) < len(data) {
+		comparer.buffer = make([]byte, len(data))
+	}
+	expectedData := comparer.buffer[:len(data)]
+	_, readErr := io.ReadFull(comparer.expected, expectedData)
+	if readErr != nil || !bytes.Equal(data, expectedData) {
+		comparer.matches = false
+	}
+
+	return
+}
+
+// progressReader is an io.Reader that reports progress as data is read.
+type progressReader struct {
+	reader      io.Reader
+	transferred int64
+	total       int64
+	progress    FTPSProgressHandler
+}
+
+func newProgressReader(reader io.Reader, total int64, progress FTPSProgressHandler) io.Reader {
+	if progress == nil {
+		return reader
+	}
+
+	return &progressReader{
+		reader:   reader,
+		total:    total,
+		progress: progress,
+	}
+}
+
+func (reader *progressReader) Read(buffer []byte) (count int, err error) {
+	count, err = reader.reader.Read(buffer)
+	if count > 0 && reader.progress != nil {
+		reader.transferred += int64(count)
+		reader.progress(reader.transferred, reader.total)
+	}
+
+	return
+}
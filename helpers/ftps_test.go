@@ -0,0 +1,300 @@
+package helpers
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrefixComparer(test *testing.T) {
+	testCases := []struct {
+		name     string
+		expected string
+		written  []string
+		matches  bool
+	}{
+		{"empty", "abcdef", []string{}, true},
+		{"exact", "abcdef", []string{"abcdef"}, true},
+		{"prefix", "abcdef", []string{"abc"}, true},
+		{"prefix in chunks", "abcdef", []string{"ab", "cd", "e"}, true},
+		{"different", "abcdef", []string{"abX"}, false},
+		{"different in later chunk", "abcdef", []string{"ab", "cX"}, false},
+		{"longer than expected", "abc", []string{"abcd"}, false},
+		{"mismatch then match", "abcdef", []string{"X", "bcdef"}, false},
+	}
+
+	for _, testCase := range testCases {
+		comparer := &prefixComparer{
+			expected: strings.NewReader(testCase.expected),
+			matches:  true,
+		}
+		for _, chunk := range testCase.written {
+			count, err := comparer.Write([]byte(chunk))
+			if err != nil {
+				test.Fatalf("%s: unexpected error: %s", testCase.name, err.Error())
+			}
+			if count != len(chunk) {
+				test.Fatalf("%s: wrote %d bytes (expected %d)", testCase.name, count, len(chunk))
+			}
+		}
+
+		if comparer.matches != testCase.matches {
+			test.Errorf("%s: matches is %t (expected %t)", testCase.name, comparer.matches, testCase.matches)
+		}
+	}
+}
+
+func TestFTPSClientUpload(test *testing.T) {
+	localData := []byte("The quick brown fox jumps over the lazy dog.")
+
+	testCases := []struct {
+		name string
+
+		// The existing remote file (nil if there is none).
+		remoteData []byte
+
+		resume        bool
+		rejectRestart bool
+
+		expectedResumedFrom int64
+		expectedRestart     bool
+	}{
+		{name: "no remote file", resume: true},
+		{name: "resume disabled", remoteData: localData[:10], resume: false},
+		{name: "matching partial file", remoteData: localData[:10], resume: true, expectedResumedFrom: 10, expectedRestart: true},
+		{name: "complete file", remoteData: localData, resume: true, expectedResumedFrom: int64(len(localData))},
+		{name: "different partial file", remoteData: []byte("The slow brown"), resume: true},
+		{name: "larger remote file", remoteData: append(append([]byte{}, localData...), '!'), resume: true},
+		{name: "empty remote file", remoteData: []byte{}, resume: true},
+		{name: "restart rejected", remoteData: localData[:10], resume: true, rejectRestart: true, expectedRestart: true},
+	}
+
+	localDir, err := ioutil.TempDir("", "ftps_test_")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(localDir)
+
+	localFile := path.Join(localDir, "disk1.vmdk")
+	err = ioutil.WriteFile(localFile, localData, 0600)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expectedDigest := sha1.Sum(localData)
+
+	for _, testCase := range testCases {
+		server := newFakeFTPSServer(test)
+		server.rejectRestart = testCase.rejectRestart
+		if testCase.remoteData != nil {
+			server.files["disk1.vmdk"] = testCase.remoteData
+		}
+		client := server.connect()
+
+		digest := sha1.New()
+		resumedFrom, err := client.Upload(localFile, "disk1.vmdk", testCase.resume, digest, nil)
+		client.Close()
+		server.close()
+
+		if err != nil {
+			test.Errorf("%s: unexpected error: %s", testCase.name, err.Error())
+
+			continue
+		}
+		if resumedFrom != testCase.expectedResumedFrom {
+			test.Errorf("%s: resumed from %d (expected %d)", testCase.name, resumedFrom, testCase.expectedResumedFrom)
+		}
+		if server.restartRequested != testCase.expectedRestart {
+			test.Errorf("%s: REST sent is %t (expected %t)", testCase.name, server.restartRequested, testCase.expectedRestart)
+		}
+		if !bytes.Equal(server.files["disk1.vmdk"], localData) {
+			test.Errorf("%s: remote file is '%s' (expected '%s')", testCase.name, server.files["disk1.vmdk"], localData)
+		}
+
+		// The digest must cover the whole file, regardless of where the upload was resumed from.
+		actualDigest := hex.EncodeToString(digest.Sum(nil))
+		if actualDigest != hex.EncodeToString(expectedDigest[:]) {
+			test.Errorf("%s: digest is '%s' (expected '%s')", testCase.name, actualDigest, hex.EncodeToString(expectedDigest[:]))
+		}
+	}
+}
+
+// fakeFTPSServer is a minimal in-process FTPS server (control connection over a pipe, TLS data connections on a local listener).
+type fakeFTPSServer struct {
+	files            map[string][]byte
+	rejectRestart    bool
+	restartRequested bool
+
+	clientConnection net.Conn
+	certificate      tls.Certificate
+	dataListener     net.Listener
+	done             chan bool
+}
+
+func newFakeFTPSServer(test *testing.T) *fakeFTPSServer {
+	clientConnection, serverConnection := net.Pipe()
+	server := &fakeFTPSServer{
+		files:            make(map[string][]byte),
+		clientConnection: clientConnection,
+		certificate:      newTestCertificate(test),
+		done:             make(chan bool),
+	}
+	go server.serve(textproto.NewConn(serverConnection))
+
+	return server
+}
+
+// Create a client that is already logged into the server.
+func (server *fakeFTPSServer) connect() *FTPSClient {
+	return &FTPSClient{
+		HostName:  "127.0.0.1",
+		tlsConfig: &tls.Config{InsecureSkipVerify: true},
+		control:   textproto.NewConn(server.clientConnection),
+	}
+}
+
+func (server *fakeFTPSServer) close() {
+	<-server.done
+	if server.dataListener != nil {
+		server.dataListener.Close()
+	}
+}
+
+func (server *fakeFTPSServer) serve(control *textproto.Conn) {
+	defer close(server.done)
+	defer control.Close()
+
+	restartOffset := 0
+	for {
+		line, err := control.ReadLine()
+		if err != nil {
+			return
+		}
+		commandParts := strings.SplitN(line, " ", 2)
+		command := commandParts[0]
+		argument := ""
+		if len(commandParts) > 1 {
+			argument = commandParts[1]
+		}
+
+		switch command {
+		case "QUIT":
+			control.PrintfLine("221 Goodbye.")
+
+			return
+		case "SIZE":
+			data, ok := server.files[argument]
+			if !ok {
+				control.PrintfLine("550 File not found.")
+
+				continue
+			}
+			control.PrintfLine("213 %d", len(data))
+		case "EPSV":
+			// Like a real server, each EPSV command listens on a new port.
+			if server.dataListener != nil {
+				server.dataListener.Close()
+			}
+			server.dataListener, err = tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+				Certificates: []tls.Certificate{server.certificate},
+			})
+			if err != nil {
+				control.PrintfLine("425 Unable to open data connection.")
+
+				continue
+			}
+			_, port, _ := net.SplitHostPort(server.dataListener.Addr().String())
+			control.PrintfLine("229 Entering Extended Passive Mode (|||%s|)", port)
+		case "REST":
+			server.restartRequested = true
+			if server.rejectRestart {
+				control.PrintfLine("502 Command not implemented.")
+
+				continue
+			}
+			restartOffset, _ = strconv.Atoi(argument)
+			control.PrintfLine("350 Restarting at %d.", restartOffset)
+		case "RETR":
+			dataConnection, err := server.acceptDataConnection()
+			if err != nil {
+				control.PrintfLine("425 Unable to open data connection.")
+
+				continue
+			}
+			control.PrintfLine("150 Opening data connection.")
+			dataConnection.Write(server.files[argument][restartOffset:])
+			dataConnection.Close()
+			restartOffset = 0
+			control.PrintfLine("226 Transfer complete.")
+		case "STOR":
+			dataConnection, err := server.acceptDataConnection()
+			if err != nil {
+				control.PrintfLine("425 Unable to open data connection.")
+
+				continue
+			}
+			control.PrintfLine("150 Opening data connection.")
+			data, _ := ioutil.ReadAll(dataConnection)
+			dataConnection.Close()
+			existingData := server.files[argument]
+			if len(existingData) > restartOffset {
+				existingData = existingData[:restartOffset]
+			}
+			server.files[argument] = append(append([]byte{}, existingData...), data...)
+			restartOffset = 0
+			control.PrintfLine("226 Transfer complete.")
+		default:
+			control.PrintfLine("502 Command not implemented.")
+		}
+	}
+}
+
+func (server *fakeFTPSServer) acceptDataConnection() (net.Conn, error) {
+	if server.dataListener == nil {
+		return nil, fmt.Errorf("No data connection (EPSV was not sent)")
+	}
+
+	return server.dataListener.Accept()
+}
+
+// Create a self-signed certificate for the fake server.
+func newTestCertificate(test *testing.T) tls.Certificate {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	certificateDER, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		test.Fatal(fmt.Errorf("Unable to create test certificate: %s", err.Error()))
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{certificateDER},
+		PrivateKey:  privateKey,
+	}
+}
@@ -0,0 +1,170 @@
+package helpers
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// OVFManifestEntry represents a single entry in an OVF manifest (.mf) file.
+type OVFManifestEntry struct {
+	// The digest algorithm (e.g. "SHA1" or "SHA256").
+	Algorithm string
+
+	// The name of the file that the entry describes.
+	FileName string
+
+	// The expected digest (lower-case hex) for the file.
+	Digest string
+}
+
+// OVFManifest represents the contents of an OVF manifest (.mf) file.
+type OVFManifest struct {
+	// The manifest entries, in the order in which they appear in the manifest file.
+	Entries []OVFManifestEntry
+}
+
+var ovfManifestEntryPattern = regexp.MustCompile(`^(SHA1|SHA256)\((.+)\)\s*=\s*([0-9a-fA-F]+)$`)
+
+// ReadOVFManifest reads the OVF manifest (.mf) file at the specified path.
+func ReadOVFManifest(manifestFile string) (manifest *OVFManifest, err error) {
+	file, err := os.Open(manifestFile)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	manifest = &OVFManifest{}
+
+	lineNumber := 0
+	lineScanner := bufio.NewScanner(file)
+	for lineScanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimSpace(lineScanner.Text())
+		if line == "" {
+			continue
+		}
+
+		match := ovfManifestEntryPattern.FindStringSubmatch(line)
+		if match == nil {
+			err = fmt.Errorf("Invalid entry on line %d of OVF manifest '%s': '%s'",
+				lineNumber,
+				manifestFile,
+				line,
+			)
+
+			return
+		}
+
+		manifest.Entries = append(manifest.Entries, OVFManifestEntry{
+			Algorithm: match[1],
+			FileName:  match[2],
+			Digest:    strings.ToLower(match[3]),
+		})
+	}
+	err = lineScanner.Err()
+
+	return
+}
+
+// Write writes the manifest to the specified OVF manifest (.mf) file.
+func (manifest *OVFManifest) Write(manifestFile string) error {
+	file, err := os.Create(manifestFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for _, entry := range manifest.Entries {
+		_, err = fmt.Fprintf(file, "%s(%s)= %s\n", entry.Algorithm, entry.FileName, entry.Digest)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetEntry retrieves the manifest entry (if any) for the specified file name.
+func (manifest *OVFManifest) GetEntry(fileName string) *OVFManifestEntry {
+	for index := range manifest.Entries {
+		entry := &manifest.Entries[index]
+		if entry.FileName == fileName {
+			return entry
+		}
+	}
+
+	return nil
+}
+
+// Verify ensures that the specified local file matches its corresponding manifest entry.
+func (manifest *OVFManifest) Verify(localFile string) error {
+	fileName := path.Base(localFile)
+
+	entry := manifest.GetEntry(fileName)
+	if entry == nil {
+		return fmt.Errorf("OVF manifest has no entry for file '%s'", fileName)
+	}
+
+	actualDigest, err := ComputeFileDigest(localFile, entry.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	if actualDigest != entry.Digest {
+		return fmt.Errorf("%s digest for file '%s' does not match OVF manifest (expected '%s', but was '%s')",
+			entry.Algorithm,
+			fileName,
+			entry.Digest,
+			actualDigest,
+		)
+	}
+
+	return nil
+}
+
+// ComputeFileDigest computes the digest (lower-case hex) of the specified local file using the specified algorithm ("SHA1" or "SHA256").
+func ComputeFileDigest(localFile string, algorithm string) (digest string, err error) {
+	hasher, err := NewDigestHasher(algorithm)
+	if err != nil {
+		return
+	}
+
+	file, err := os.Open(localFile)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	_, err = io.Copy(hasher, file)
+	if err != nil {
+		return
+	}
+
+	digest = hex.EncodeToString(
+		hasher.Sum(nil),
+	)
+
+	return
+}
+
+// NewDigestHasher creates a hash.Hash for the specified OVF manifest digest algorithm ("SHA1" or "SHA256").
+func NewDigestHasher(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "SHA1":
+		return sha1.New(), nil
+	case "SHA256":
+		return sha256.New(), nil
+	default:
+		return nil, fmt.Errorf("Unsupported OVF manifest digest algorithm '%s'", algorithm)
+	}
+}
@@ -0,0 +1,175 @@
+package helpers
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// SHA1 and SHA256 digests of "hello\n".
+const (
+	testHelloSHA1   = "f572d396fae9206628714fb2ce00f72e94f2258f"
+	testHelloSHA256 = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+)
+
+func TestReadOVFManifest(test *testing.T) {
+	testCases := []struct {
+		name            string
+		content         string
+		expectedEntries []OVFManifestEntry
+		expectError     bool
+	}{
+		{
+			name:    "SHA1 and SHA256",
+			content: "SHA1(image.ovf)= " + testHelloSHA1 + "\nSHA256(disk1.vmdk)= " + testHelloSHA256 + "\n",
+			expectedEntries: []OVFManifestEntry{
+				{Algorithm: "SHA1", FileName: "image.ovf", Digest: testHelloSHA1},
+				{Algorithm: "SHA256", FileName: "disk1.vmdk", Digest: testHelloSHA256},
+			},
+		},
+		{
+			name:    "upper-case digest, no space, blank lines, and CRLF",
+			content: "\r\nSHA1(image.ovf)=" + strings.ToUpper(testHelloSHA1) + "\r\n\r\n",
+			expectedEntries: []OVFManifestEntry{
+				{Algorithm: "SHA1", FileName: "image.ovf", Digest: testHelloSHA1},
+			},
+		},
+		{
+			name:    "file name containing parentheses",
+			content: "SHA1(disk (1).vmdk)= " + testHelloSHA1 + "\n",
+			expectedEntries: []OVFManifestEntry{
+				{Algorithm: "SHA1", FileName: "disk (1).vmdk", Digest: testHelloSHA1},
+			},
+		},
+		{
+			name:        "unsupported algorithm",
+			content:     "MD5(image.ovf)= b1946ac92492d2347c6235b4d2611184\n",
+			expectError: true,
+		},
+		{
+			name:        "invalid digest",
+			content:     "SHA1(image.ovf)= not-a-digest\n",
+			expectError: true,
+		},
+	}
+
+	directory := newTestDirectory(test)
+	defer os.RemoveAll(directory)
+
+	for _, testCase := range testCases {
+		manifestFile := writeTestFile(test, directory, "image.mf", testCase.content)
+
+		manifest, err := ReadOVFManifest(manifestFile)
+		if testCase.expectError {
+			if err == nil {
+				test.Errorf("%s: expected an error", testCase.name)
+			}
+
+			continue
+		}
+		if err != nil {
+			test.Errorf("%s: unexpected error: %s", testCase.name, err.Error())
+
+			continue
+		}
+
+		if !reflect.DeepEqual(manifest.Entries, testCase.expectedEntries) {
+			test.Errorf("%s: entries are %#v (expected %#v)", testCase.name, manifest.Entries, testCase.expectedEntries)
+		}
+	}
+}
+
+func TestOVFManifestWriteRoundTrip(test *testing.T) {
+	directory := newTestDirectory(test)
+	defer os.RemoveAll(directory)
+
+	manifest := &OVFManifest{
+		Entries: []OVFManifestEntry{
+			{Algorithm: "SHA1", FileName: "image.ovf", Digest: testHelloSHA1},
+			{Algorithm: "SHA256", FileName: "disk1.vmdk", Digest: testHelloSHA256},
+		},
+	}
+
+	manifestFile := path.Join(directory, "image.mf")
+	err := manifest.Write(manifestFile)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(manifestFile)
+	if err != nil {
+		test.Fatal(err)
+	}
+	expectedContent := "SHA1(image.ovf)= " + testHelloSHA1 + "\nSHA256(disk1.vmdk)= " + testHelloSHA256 + "\n"
+	if string(content) != expectedContent {
+		test.Fatalf("manifest content is '%s' (expected '%s')", content, expectedContent)
+	}
+
+	readManifest, err := ReadOVFManifest(manifestFile)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !reflect.DeepEqual(readManifest, manifest) {
+		test.Fatalf("read manifest is %#v (expected %#v)", readManifest, manifest)
+	}
+}
+
+func TestOVFManifestVerify(test *testing.T) {
+	directory := newTestDirectory(test)
+	defer os.RemoveAll(directory)
+
+	manifest := &OVFManifest{
+		Entries: []OVFManifestEntry{
+			{Algorithm: "SHA1", FileName: "image.ovf", Digest: testHelloSHA1},
+			{Algorithm: "SHA256", FileName: "disk1.vmdk", Digest: testHelloSHA256},
+			{Algorithm: "SHA1", FileName: "stale.vmdk", Digest: testHelloSHA1},
+			{Algorithm: "SHA512", FileName: "other.vmdk", Digest: testHelloSHA1},
+		},
+	}
+
+	testCases := []struct {
+		fileName    string
+		content     string
+		expectError bool
+	}{
+		{"image.ovf", "hello\n", false},
+		{"disk1.vmdk", "hello\n", false},
+		{"stale.vmdk", "goodbye\n", true},
+		{"missing.vmdk", "hello\n", true},
+		{"other.vmdk", "hello\n", true},
+	}
+
+	for _, testCase := range testCases {
+		localFile := writeTestFile(test, directory, testCase.fileName, testCase.content)
+
+		err := manifest.Verify(localFile)
+		if testCase.expectError && err == nil {
+			test.Errorf("%s: expected an error", testCase.fileName)
+		}
+		if !testCase.expectError && err != nil {
+			test.Errorf("%s: unexpected error: %s", testCase.fileName, err.Error())
+		}
+	}
+}
+
+func newTestDirectory(test *testing.T) string {
+	directory, err := ioutil.TempDir("", "ovf_manifest_test_")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	return directory
+}
+
+func writeTestFile(test *testing.T, directory string, fileName string, content string) string {
+	localFile := path.Join(directory, fileName)
+	err := ioutil.WriteFile(localFile, []byte(content), 0600)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	return localFile
+}
@@ -0,0 +1,78 @@
+package helpers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/DimensionDataResearch/go-dd-cloud-compute/compute"
+)
+
+// DefaultPublicIPDiscoveryURL is the default URL used to discover the caller's public IPv4 address.
+const DefaultPublicIPDiscoveryURL = "https://api.ipify.org/"
+
+// DiscoverPublicIPv4Address determines the caller's public IPv4 address.
+//
+// The discovery URL is expected to return the address (and nothing else) as plain text.
+func DiscoverPublicIPv4Address(discoveryURL string) (address string, err error) {
+	httpClient := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	response, err := httpClient.Get(discoveryURL)
+	if err != nil {
+		err = fmt.Errorf("Unable to discover public IPv4 address via '%s': %s", discoveryURL, err.Error())
+
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("Unable to discover public IPv4 address via '%s': unexpected response status '%s'", discoveryURL, response.Status)
+
+		return
+	}
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		err = fmt.Errorf("Unable to discover public IPv4 address via '%s': %s", discoveryURL, err.Error())
+
+		return
+	}
+
+	address = strings.TrimSpace(string(responseBody))
+	ipAddress := net.ParseIP(address)
+	if ipAddress == nil || ipAddress.To4() == nil {
+		err = fmt.Errorf("Unable to discover public IPv4 address via '%s': response '%s' is not a valid IPv4 address", discoveryURL, address)
+		address = ""
+	}
+
+	return
+}
+
+// IsPublicIPBlockInUse determines whether any addresses in the specified public IP block are reserved (e.g. by NAT rules or VIPs).
+func IsPublicIPBlockInUse(client *compute.Client, networkDomainID string, publicIPBlockID string) (bool, error) {
+	page := compute.DefaultPaging()
+	for {
+		reservedIPs, err := client.ListReservedPublicIPAddresses(networkDomainID, page)
+		if err != nil {
+			return false, err
+		}
+		if reservedIPs.IsEmpty() {
+			break // We're done
+		}
+
+		for _, reservedIP := range reservedIPs.Items {
+			if reservedIP.IPBlockID == publicIPBlockID {
+				return true, nil
+			}
+		}
+
+		page.Next()
+	}
+
+	return false, nil
+}
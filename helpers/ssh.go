@@ -0,0 +1,150 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHPrivateKeyFileAuth creates an SSH authentication method that uses the private key in the specified file.
+func SSHPrivateKeyFileAuth(privateKeyFile string) (authMethod gossh.AuthMethod, err error) {
+	privateKeyPEM, err := ioutil.ReadFile(privateKeyFile)
+	if err != nil {
+		err = fmt.Errorf("Unable to read SSH private key file '%s': %s", privateKeyFile, err.Error())
+
+		return
+	}
+
+	authMethod, err = SSHPrivateKeyAuth(privateKeyPEM)
+	if err != nil {
+		err = fmt.Errorf("Unable to parse SSH private key file '%s': %s", privateKeyFile, err.Error())
+	}
+
+	return
+}
+
+// SSHPrivateKeyAuth creates an SSH authentication method that uses the specified (PEM-encoded) private key.
+func SSHPrivateKeyAuth(privateKeyPEM []byte) (authMethod gossh.AuthMethod, err error) {
+	signer, err := gossh.ParsePrivateKey(privateKeyPEM)
+	if err != nil {
+		return
+	}
+
+	authMethod = gossh.PublicKeys(signer)
+
+	return
+}
+
+// SSHAgentAuth creates an SSH authentication method that uses the local SSH agent (identified by the SSH_AUTH_SOCK environment variable).
+func SSHAgentAuth() (authMethod gossh.AuthMethod, err error) {
+	agentSocket := os.Getenv("SSH_AUTH_SOCK")
+	if agentSocket == "" {
+		err = fmt.Errorf("SSH agent authentication was requested, but the SSH_AUTH_SOCK environment variable has not been set")
+
+		return
+	}
+
+	agentConnection, err := net.Dial("unix", agentSocket)
+	if err != nil {
+		err = fmt.Errorf("Unable to connect to SSH agent via '%s': %s", agentSocket, err.Error())
+
+		return
+	}
+
+	authMethod = gossh.PublicKeysCallback(
+		agent.NewClient(agentConnection).Signers,
+	)
+
+	return
+}
+
+// SSHHostKeyCallback creates a callback that verifies SSH host keys.
+//
+// If hostKeyFingerprint is specified, then the host key's fingerprint (SHA256 or MD5 format) must match it.
+// If knownHostsFile is specified, then the host key must appear in that file.
+// If neither is specified, then any host key will be accepted.
+func SSHHostKeyCallback(hostKeyFingerprint string, knownHostsFile string) (callback gossh.HostKeyCallback, err error) {
+	var knownHostsCallback gossh.HostKeyCallback
+	if knownHostsFile != "" {
+		knownHostsCallback, err = knownhosts.New(knownHostsFile)
+		if err != nil {
+			err = fmt.Errorf("Unable to read SSH known hosts file '%s': %s", knownHostsFile, err.Error())
+
+			return
+		}
+	}
+
+	if hostKeyFingerprint == "" && knownHostsCallback == nil {
+		callback = gossh.InsecureIgnoreHostKey()
+
+		return
+	}
+
+	callback = func(hostname string, remote net.Addr, key gossh.PublicKey) error {
+		if hostKeyFingerprint != "" && !MatchSSHHostKeyFingerprint(key, hostKeyFingerprint) {
+			return fmt.Errorf("SSH host key for '%s' has fingerprint '%s' (expected '%s')",
+				hostname,
+				gossh.FingerprintSHA256(key),
+				hostKeyFingerprint,
+			)
+		}
+
+		if knownHostsCallback != nil {
+			return knownHostsCallback(hostname, remote, key)
+		}
+
+		return nil
+	}
+
+	return
+}
+
+// MatchSSHHostKeyFingerprint determines whether the specified public key matches the specified fingerprint (SHA256 or MD5 format).
+func MatchSSHHostKeyFingerprint(key gossh.PublicKey, fingerprint string) bool {
+	if strings.HasPrefix(fingerprint, "SHA256:") {
+		return gossh.FingerprintSHA256(key) == fingerprint
+	}
+
+	fingerprint = strings.TrimPrefix(fingerprint, "MD5:")
+
+	return strings.EqualFold(gossh.FingerprintLegacyMD5(key), fingerprint)
+}
+
+// GenerateSSHKeyPair generates a new RSA key pair for use with SSH.
+//
+// Returns the PEM-encoded private key, and the public key in authorized_keys format (with the specified comment).
+func GenerateSSHKeyPair(comment string) (privateKeyPEM []byte, authorizedKey string, err error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return
+	}
+
+	privateKeyPEM = pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	})
+
+	publicKey, err := gossh.NewPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return
+	}
+
+	authorizedKey = strings.TrimSpace(
+		string(gossh.MarshalAuthorizedKey(publicKey)),
+	)
+	if comment != "" {
+		authorizedKey += " " + comment
+	}
+
+	return
+}
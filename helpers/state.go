@@ -229,19 +229,51 @@ func (state State) SetNATRule(natRule *compute.NATRule) {
 	state.Data.Put("nat_rule", natRule)
 }
 
-// GetFirewallRule gets the firewall rule from the state data.
-func (state State) GetFirewallRule() *compute.FirewallRule {
-	value, ok := state.Data.GetOk("firewall_rule")
+// GetAllocatedPublicIPBlockID gets the Id of the public IP block (if any) allocated by the build from the state data.
+func (state State) GetAllocatedPublicIPBlockID() string {
+	value, ok := state.Data.GetOk("allocated_public_ip_block_id")
+	if !ok || value == nil {
+		return ""
+	}
+
+	return value.(string)
+}
+
+// SetAllocatedPublicIPBlockID updates the Id of the public IP block (if any) allocated by the build in the state data.
+func (state State) SetAllocatedPublicIPBlockID(publicIPBlockID string) {
+	state.Data.Put("allocated_public_ip_block_id", publicIPBlockID)
+}
+
+// GetRetainBuildResources determines whether build resources should be retained (rather than destroyed) during cleanup.
+//
+// decided is false if no decision has been recorded in the state data yet.
+func (state State) GetRetainBuildResources() (retain bool, decided bool) {
+	value, ok := state.Data.GetOk("retain_build_resources")
+	if !ok || value == nil {
+		return false, false
+	}
+
+	return value.(bool), true
+}
+
+// SetRetainBuildResources records whether build resources should be retained (rather than destroyed) during cleanup in the state data.
+func (state State) SetRetainBuildResources(retain bool) {
+	state.Data.Put("retain_build_resources", retain)
+}
+
+// GetFirewallRules gets the firewall rules from the state data.
+func (state State) GetFirewallRules() []*compute.FirewallRule {
+	value, ok := state.Data.GetOk("firewall_rules")
 	if !ok || value == nil {
 		return nil
 	}
 
-	return value.(*compute.FirewallRule)
+	return value.([]*compute.FirewallRule)
 }
 
-// SetFirewallRule updates the firewall rule in the state data.
-func (state State) SetFirewallRule(firewallRule *compute.FirewallRule) {
-	state.Data.Put("firewall_rule", firewallRule)
+// SetFirewallRules updates the firewall rules in the state data.
+func (state State) SetFirewallRules(firewallRules []*compute.FirewallRule) {
+	state.Data.Put("firewall_rules", firewallRules)
 }
 
 // GetSourceImage gets the source image from the state data.
@@ -289,6 +321,21 @@ func (state State) SetTargetImage(image *compute.CustomerImage) {
 	state.Data.Put("target_image", image)
 }
 
+// GetReplacedImage gets the existing image (if any) that will be replaced by the target image from the state data.
+func (state State) GetReplacedImage() *compute.CustomerImage {
+	value, ok := state.Data.GetOk("replaced_image")
+	if !ok || value == nil {
+		return nil
+	}
+
+	return value.(*compute.CustomerImage)
+}
+
+// SetReplacedImage updates the existing image that will be replaced by the target image in the state data.
+func (state State) SetReplacedImage(image *compute.CustomerImage) {
+	state.Data.Put("replaced_image", image)
+}
+
 // GetTargetImageArtifact gets the target image artifact from the state data.
 func (state State) GetTargetImageArtifact() *artifacts.Image {
 	value, ok := state.Data.GetOk("target_image_artifact")
@@ -349,6 +396,21 @@ func (state State) SetTargetArtifact(targetArtifact packer.Artifact) {
 	state.Data.Put("target_artifact", targetArtifact)
 }
 
+// GetTemporarySSHPrivateKey gets the temporary SSH private key (if any) from the state data.
+func (state State) GetTemporarySSHPrivateKey() []byte {
+	value, ok := state.Data.GetOk("temporary_ssh_private_key")
+	if !ok || value == nil {
+		return nil
+	}
+
+	return value.([]byte)
+}
+
+// SetTemporarySSHPrivateKey updates the temporary SSH private key in the state data.
+func (state State) SetTemporarySSHPrivateKey(privateKeyPEM []byte) {
+	state.Data.Put("temporary_ssh_private_key", privateKeyPEM)
+}
+
 // ShowMessage displays the specified message via the UI (if available, otherwise via log.Printf).
 func (state State) ShowMessage(message string, formatArgs ...interface{}) {
 	ui := state.GetUI()
@@ -0,0 +1,204 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/helpers"
+	"github.com/mitchellh/packer/common"
+	"github.com/mitchellh/packer/helper/communicator"
+	"github.com/mitchellh/packer/packer"
+)
+
+// Settings represents the settings for the customer image copy post-processor.
+type Settings struct {
+	PackerConfig common.PackerConfig `mapstructure:",squash"`
+
+	McpRegion        string `mapstructure:"mcp_region"`
+	McpUser          string `mapstructure:"mcp_user"`
+	McpPassword      string `mapstructure:"mcp_password"`
+	OVFPackagePrefix string `mapstructure:"ovf_package_prefix"`
+
+	Targets []*TargetSettings `mapstructure:"targets"`
+
+	// Optional suffix (e.g. "-{{timestamp}}") appended to the name of each copy; see GetTargetImageName.
+	TargetImageSuffix string `mapstructure:"target_image_suffix"`
+
+	// Replace existing images in the target datacenters (see the CheckTargetImage step)?
+	Force bool `mapstructure:"force"`
+
+	FTPSCACertFile    string `mapstructure:"ftps_ca_cert_file"`
+	FTPSSkipVerify    bool   `mapstructure:"ftps_skip_verify"`
+	UploadParallelism int    `mapstructure:"upload_parallelism"`
+}
+
+var _ helpers.PluginConfig = &Settings{}
+
+// Characters that are not permitted in an OVF package prefix.
+var invalidOVFPackagePrefixCharacters = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// SanitizeOVFPackagePrefix converts the specified image name into a valid OVF package prefix (by replacing any characters that are not permitted with "_").
+func SanitizeOVFPackagePrefix(imageName string) string {
+	return invalidOVFPackagePrefixCharacters.ReplaceAllString(imageName, "_")
+}
+
+// GetPackerConfig retrieves the common Packer configuration for the plugin.
+func (settings *Settings) GetPackerConfig() *common.PackerConfig {
+	return &settings.PackerConfig
+}
+
+// GetCommunicatorConfig retrieves the Packer communicator configuration (if available) for the plugin.
+func (settings *Settings) GetCommunicatorConfig() *communicator.Config {
+	return nil
+}
+
+// GetMCPUser retrieves the Cloud Control user name.
+func (settings *Settings) GetMCPUser() string {
+	return settings.McpUser
+}
+
+// GetMCPPassword retrieves the Cloud Control password.
+func (settings *Settings) GetMCPPassword() string {
+	return settings.McpPassword
+}
+
+// GetTargetImageName retrieves the name of the copy of the specified source image to create for the specified target
+// (the target's TargetImageName or, if not specified, the source image name, followed by TargetImageSuffix if specified).
+func (settings *Settings) GetTargetImageName(target *TargetSettings, sourceImageName string) string {
+	targetImageName := target.TargetImageName
+	if targetImageName == "" {
+		targetImageName = sourceImageName
+	}
+
+	return targetImageName + settings.TargetImageSuffix
+}
+
+// Validate determines if the settings is valid.
+func (settings *Settings) Validate() (err error) {
+	if settings.McpRegion == "" {
+		settings.McpRegion = os.Getenv("MCP_REGION")
+
+		if settings.McpRegion == "" {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("'mcp_region' has not been specified in settings and the MCP_REGION environment variable has not been set"),
+			)
+		}
+	}
+	if settings.McpUser == "" {
+		settings.McpUser = os.Getenv("MCP_USER")
+
+		if settings.McpUser == "" {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("'mcp_user' has not been specified in settings and the MCP_USER environment variable has not been set"),
+			)
+		}
+	}
+	if settings.McpPassword == "" {
+		settings.McpPassword = os.Getenv("MCP_PASSWORD")
+
+		if settings.McpPassword == "" {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("'mcp_password' has not been specified in settings and the MCP_PASSWORD environment variable has not been set"),
+			)
+		}
+	}
+	if settings.OVFPackagePrefix != "" && invalidOVFPackagePrefixCharacters.MatchString(settings.OVFPackagePrefix) {
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("'ovf_package_prefix' ('%s') can only contain letters, digits, '-', and '_'", settings.OVFPackagePrefix),
+		)
+	}
+	if len(settings.Targets) == 0 {
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("'targets' has not been specified in settings"),
+		)
+	}
+	for index, target := range settings.Targets {
+		targetError := target.validate(settings)
+		if targetError != nil {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("Invalid settings for target %d: %s", index+1, targetError.Error()),
+			)
+		}
+	}
+	if settings.UploadParallelism == 0 {
+		settings.UploadParallelism = 2
+	} else if settings.UploadParallelism < 0 {
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("'upload_parallelism' cannot be negative"),
+		)
+	}
+	if settings.FTPSCACertFile != "" {
+		if _, statErr := os.Stat(settings.FTPSCACertFile); statErr != nil {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("'ftps_ca_cert_file' ('%s') cannot be accessed: %s", settings.FTPSCACertFile, statErr.Error()),
+			)
+		}
+	}
+
+	return
+}
+
+// TargetSettings represents the settings for a single copy of the image.
+//
+// Region and credentials default to those of the source image.
+type TargetSettings struct {
+	McpRegion       string `mapstructure:"mcp_region"`
+	McpUser         string `mapstructure:"mcp_user"`
+	McpPassword     string `mapstructure:"mcp_password"`
+	DatacenterID    string `mapstructure:"datacenter"`
+	TargetImageName string `mapstructure:"target_image"`
+
+	packerConfig *common.PackerConfig
+}
+
+var _ helpers.PluginConfig = &TargetSettings{}
+
+// GetPackerConfig retrieves the common Packer configuration for the plugin.
+func (target *TargetSettings) GetPackerConfig() *common.PackerConfig {
+	return target.packerConfig
+}
+
+// GetCommunicatorConfig retrieves the Packer communicator configuration (if available) for the plugin.
+func (target *TargetSettings) GetCommunicatorConfig() *communicator.Config {
+	return nil
+}
+
+// GetMCPUser retrieves the Cloud Control user name.
+func (target *TargetSettings) GetMCPUser() string {
+	return target.McpUser
+}
+
+// GetMCPPassword retrieves the Cloud Control password.
+func (target *TargetSettings) GetMCPPassword() string {
+	return target.McpPassword
+}
+
+// UsesSourceClient determines whether the target uses the same region and credentials as the source image.
+func (target *TargetSettings) UsesSourceClient(settings *Settings) bool {
+	return target.McpRegion == settings.McpRegion &&
+		target.McpUser == settings.McpUser &&
+		target.McpPassword == settings.McpPassword
+}
+
+// Validate the target settings (applying defaults from the post-processor settings).
+func (target *TargetSettings) validate(settings *Settings) (err error) {
+	target.packerConfig = &settings.PackerConfig
+
+	if target.McpRegion == "" {
+		target.McpRegion = settings.McpRegion
+	}
+	if target.McpUser == "" {
+		target.McpUser = settings.McpUser
+	}
+	if target.McpPassword == "" {
+		target.McpPassword = settings.McpPassword
+	}
+	if target.DatacenterID == "" {
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("'datacenter' has not been specified"),
+		)
+	}
+
+	return
+}
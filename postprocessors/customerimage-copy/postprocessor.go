@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/DimensionDataResearch/go-dd-cloud-compute/compute"
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/artifacts"
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/helpers"
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/postprocessors/customerimage-copy/config"
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/steps"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"github.com/mitchellh/packer/template/interpolate"
+
+	confighelper "github.com/mitchellh/packer/helper/config"
+)
+
+// BuilderID is the unique Id for artifacts produced by the customer image copy post-processor.
+const BuilderID = "ddcloud.images"
+
+// The builder Id for each copy of the image.
+const imageBuilderID = "ddcloud.image"
+
+// PostProcessor is the customer image copy post-processor plugin for Packer.
+type PostProcessor struct {
+	settings             *config.Settings
+	interpolationContext interpolate.Context
+	client               *compute.Client
+}
+
+// Configure is responsible for setting up configuration, storing the state for later,
+// and returning and errors, such as validation errors.
+func (postProcessor *PostProcessor) Configure(settings ...interface{}) (err error) {
+	if len(settings) == 0 {
+		err = fmt.Errorf("No settings")
+
+		return
+	}
+
+	// Builder settings.
+	postProcessor.settings = &config.Settings{}
+	err = confighelper.Decode(postProcessor.settings, &confighelper.DecodeOpts{
+		Interpolate:        true,
+		InterpolateContext: &postProcessor.interpolationContext,
+	}, settings...)
+	if err != nil {
+		return
+	}
+
+	err = postProcessor.settings.Validate()
+	if err != nil {
+		return
+	}
+
+	postProcessor.client = createClient(
+		postProcessor.settings.McpRegion,
+		postProcessor.settings.McpUser,
+		postProcessor.settings.McpPassword,
+	)
+
+	return nil
+}
+
+// PostProcess takes a previously created Artifact and produces another Artifact.
+//
+// If an error occurs, it should return that error.
+// If `keep` is to true, then the previous artifact is forcibly kept.
+func (postProcessor *PostProcessor) PostProcess(ui packer.Ui, sourceArtifact packer.Artifact) (destinationArtifact packer.Artifact, keep bool, err error) {
+	if sourceArtifact.BuilderId() != imageBuilderID {
+		err = fmt.Errorf("The source artifact is not a CloudControl image.")
+
+		return
+	}
+
+	settings := postProcessor.settings
+	client := postProcessor.client
+
+	var sourceImage *compute.CustomerImage
+	sourceImageID := sourceArtifact.Id()
+	sourceImage, err = client.GetCustomerImage(sourceImageID)
+	if err != nil {
+		return
+	}
+	if sourceImage == nil {
+		err = fmt.Errorf("Cannot find customer image '%s'",
+			sourceImageID,
+		)
+
+		return
+	}
+
+	packagePrefix := settings.OVFPackagePrefix
+	if packagePrefix == "" {
+		// Image names can contain characters (e.g. spaces) that are not valid in an OVF package prefix.
+		packagePrefix = config.SanitizeOVFPackagePrefix(sourceImage.Name)
+	}
+
+	// Export the source image, and download it to a temporary directory.
+	packageDirectory, err := ioutil.TempDir(
+		"",                   // Use default temp directory
+		"packer_image_copy_", // Directory prefix
+	)
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(packageDirectory)
+
+	packageArtifact, err := postProcessor.exportImage(ui, sourceImage, packagePrefix, packageDirectory)
+	if err != nil {
+		return
+	}
+
+	// Then upload and import it into each target datacenter.
+	imagesArtifact := &artifacts.Images{
+		BuilderID: BuilderID,
+	}
+	for _, target := range settings.Targets {
+		var imageArtifact *artifacts.Image
+		imageArtifact, err = postProcessor.importImage(ui, sourceImage, target, packagePrefix, packageArtifact)
+		if err != nil {
+			// Don't leave partial copies lying around.
+			destroyError := imagesArtifact.Destroy()
+			if destroyError != nil {
+				ui.Error(destroyError.Error())
+			}
+
+			return
+		}
+
+		imagesArtifact.Images = append(imagesArtifact.Images, imageArtifact)
+	}
+
+	destinationArtifact = imagesArtifact
+
+	// The source image is not included in the copies, so keep it.
+	keep = true
+
+	return
+}
+
+var _ packer.PostProcessor = &PostProcessor{}
+
+// Export the source image to an OVF package, and download it to the specified local directory.
+func (postProcessor *PostProcessor) exportImage(ui packer.Ui, sourceImage *compute.CustomerImage, packagePrefix string, packageDirectory string) (packageArtifact packer.Artifact, err error) {
+	settings := postProcessor.settings
+
+	stepState := helpers.ForStateBag(
+		&multistep.BasicStateBag{},
+	)
+	stepState.SetUI(ui)
+	stepState.SetPackerConfig(&settings.PackerConfig)
+	stepState.SetSettings(settings)
+	stepState.SetClient(postProcessor.client)
+	stepState.SetBuilderID(imageBuilderID)
+	stepState.SetTargetImage(sourceImage)
+	stepState.SetTargetImageArtifact(&artifacts.Image{
+		Image:     sourceImage,
+		BuilderID: imageBuilderID,
+	})
+
+	runner := &multistep.BasicRunner{
+		Steps: []multistep.Step{
+			&steps.ExportCustomerImage{
+				OVFPackagePrefix: packagePrefix,
+			},
+			&steps.DownloadOVFPackage{
+				TargetDirectory:     packageDirectory,
+				FTPSCACertFile:      settings.FTPSCACertFile,
+				FTPSSkipVerify:      settings.FTPSSkipVerify,
+				DeleteRemotePackage: true,
+			},
+		},
+	}
+	runner.Run(stepState.Data)
+
+	err = stepState.GetLastError()
+	if err != nil {
+		return
+	}
+
+	packageArtifact = stepState.GetTargetArtifact()
+	if packageArtifact == nil {
+		err = fmt.Errorf("Failed to export customer image '%s' ('%s')", sourceImage.Name, sourceImage.ID)
+	}
+
+	return
+}
+
+// Upload the OVF package to the target datacenter, and import it as a customer image.
+func (postProcessor *PostProcessor) importImage(ui packer.Ui, sourceImage *compute.CustomerImage, target *config.TargetSettings, packagePrefix string, packageArtifact packer.Artifact) (imageArtifact *artifacts.Image, err error) {
+	settings := postProcessor.settings
+
+	targetImageName := settings.GetTargetImageName(target, sourceImage.Name)
+
+	// Only create a new client if the target is in a different region (or uses different credentials).
+	client := postProcessor.client
+	if !target.UsesSourceClient(settings) {
+		client = createClient(target.McpRegion, target.McpUser, target.McpPassword)
+	}
+
+	ui.Say(fmt.Sprintf(
+		"Copying customer image '%s' ('%s') to datacenter '%s' as '%s'...",
+		sourceImage.Name,
+		sourceImage.ID,
+		target.DatacenterID,
+		targetImageName,
+	))
+
+	stepState := helpers.ForStateBag(
+		&multistep.BasicStateBag{},
+	)
+	stepState.SetUI(ui)
+	stepState.SetPackerConfig(&settings.PackerConfig)
+	stepState.SetSettings(target)
+	stepState.SetClient(client)
+	stepState.SetBuilderID(imageBuilderID)
+	stepState.SetSourceArtifact(packageArtifact)
+
+	runner := &multistep.BasicRunner{
+		Steps: []multistep.Step{
+			&steps.ResolveDatacenter{
+				DatacenterID: target.DatacenterID,
+				AsTarget:     true,
+			},
+			&steps.CheckTargetImage{
+				TargetImage: targetImageName,
+				Force:       settings.Force,
+			},
+			&steps.UploadOVFPackage{
+				FTPSCACertFile: settings.FTPSCACertFile,
+				FTPSSkipVerify: settings.FTPSSkipVerify,
+				Parallelism:    settings.UploadParallelism,
+			},
+			&steps.ImportCustomerImage{
+				TargetImageName:  targetImageName,
+				DatacenterID:     target.DatacenterID,
+				OVFPackagePrefix: packagePrefix,
+			},
+		},
+	}
+	runner.Run(stepState.Data)
+
+	err = stepState.GetLastError()
+	if err != nil {
+		return
+	}
+
+	imageArtifact = stepState.GetTargetImageArtifact()
+	if imageArtifact == nil {
+		err = fmt.Errorf("Failed to copy customer image '%s' ('%s') to datacenter '%s'", sourceImage.Name, sourceImage.ID, target.DatacenterID)
+
+		return
+	}
+	imageArtifact.SourceImageID = sourceImage.ID
+
+	return
+}
+
+// Create a CloudControl API client.
+func createClient(region string, user string, password string) *compute.Client {
+	client := compute.NewClient(region, user, password)
+	if os.Getenv("MCP_EXTENDED_LOGGING") != "" {
+		client.EnableExtendedLogging()
+	}
+
+	return client
+}
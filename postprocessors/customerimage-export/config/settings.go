@@ -21,6 +21,9 @@ type Settings struct {
 	TargetImageName          string `mapstructure:"target_image"`
 	OVFPackagePrefix         string `mapstructure:"ovf_package_prefix"`
 	DownloadToLocalDirectory string `mapstructure:"download_to_local_directory"`
+
+	FTPSCACertFile string `mapstructure:"ftps_ca_cert_file"`
+	FTPSSkipVerify bool   `mapstructure:"ftps_skip_verify"`
 }
 
 var _ helpers.PluginConfig = &Settings{}
@@ -87,10 +90,12 @@ func (settings *Settings) Validate() (err error) {
 	if settings.OVFPackagePrefix == "" {
 		settings.OVFPackagePrefix = settings.TargetImageName
 	}
-	if settings.DownloadToLocalDirectory != "" {
-		err = packer.MultiErrorAppend(err,
-			fmt.Errorf("'download_to_local_directory' is not supported yet"),
-		)
+	if settings.FTPSCACertFile != "" {
+		if _, statErr := os.Stat(settings.FTPSCACertFile); statErr != nil {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("'ftps_ca_cert_file' ('%s') cannot be accessed: %s", settings.FTPSCACertFile, statErr.Error()),
+			)
+		}
 	}
 
 	return
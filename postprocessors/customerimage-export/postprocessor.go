@@ -58,16 +58,26 @@ func (postProcessor *PostProcessor) Configure(settings ...interface{}) (err erro
 	}
 
 	// Configure post-processor execution logic.
-	postProcessor.runner = &multistep.BasicRunner{
-		Steps: []multistep.Step{
-			&steps.ResolveSourceImage{
-				ImageName:           postProcessor.settings.TargetImageName,
-				DatacenterID:        postProcessor.settings.DatacenterID,
-				MustBeCustomerImage: true,
-			},
-			&steps.ExportCustomerImage{},
+	runnerSteps := []multistep.Step{
+		&steps.ResolveSourceImage{
+			ImageName:           postProcessor.settings.TargetImageName,
+			DatacenterID:        postProcessor.settings.DatacenterID,
+			MustBeCustomerImage: true,
+		},
+		&steps.ExportCustomerImage{
+			OVFPackagePrefix: postProcessor.settings.OVFPackagePrefix,
 		},
 	}
+	if postProcessor.settings.DownloadToLocalDirectory != "" {
+		runnerSteps = append(runnerSteps, &steps.DownloadOVFPackage{
+			TargetDirectory: postProcessor.settings.DownloadToLocalDirectory,
+			FTPSCACertFile:  postProcessor.settings.FTPSCACertFile,
+			FTPSSkipVerify:  postProcessor.settings.FTPSSkipVerify,
+		})
+	}
+	postProcessor.runner = &multistep.BasicRunner{
+		Steps: runnerSteps,
+	}
 
 	return nil
 }
@@ -120,7 +130,14 @@ func (postProcessor *PostProcessor) PostProcess(ui packer.Ui, sourceArtifact pac
 		return
 	}
 
-	destinationArtifact = stepState.GetRemoteOVFPackageArtifact()
+	if settings.DownloadToLocalDirectory != "" {
+		destinationArtifact = stepState.GetTargetArtifact()
+	} else {
+		destinationArtifact = stepState.GetRemoteOVFPackageArtifact()
+	}
+
+	// Exporting the image does not replace it, so always keep it (destroying the source artifact would delete the customer image).
+	keep = true
 
 	return
 }
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/DimensionDataResearch/packer-plugins-ddcloud/helpers"
 	"github.com/mitchellh/packer/common"
@@ -20,6 +21,33 @@ type Settings struct {
 	DatacenterID     string `mapstructure:"datacenter"`
 	TargetImageName  string `mapstructure:"target_image"`
 	OVFPackagePrefix string `mapstructure:"ovf_package_prefix"`
+
+	// Versioning / replacement of the imported image (see GetTargetImageName and the CheckTargetImage step).
+	TargetImageSuffix string `mapstructure:"target_image_suffix"`
+	Force             bool   `mapstructure:"force"`
+
+	FTPSCACertFile string `mapstructure:"ftps_ca_cert_file"`
+	FTPSSkipVerify bool   `mapstructure:"ftps_skip_verify"`
+
+	UploadParallelism int  `mapstructure:"upload_parallelism"`
+	KeepOVFPackage    bool `mapstructure:"keep_ovf_package"`
+	ResumeUpload      bool `mapstructure:"resume_upload"`
+
+	// If specified, the OVF descriptor is changed to use this guest OS type / virtual hardware version.
+	GuestOSType            string `mapstructure:"guest_os_type"`
+	VirtualHardwareVersion string `mapstructure:"virtual_hardware_version"`
+
+	// Settings for VMWare virtual machines that are converted to OVF using ovftool.
+	DiskCompression int      `mapstructure:"disk_compression"`
+	DiskMode        string   `mapstructure:"disk_mode"`
+	OVFToolArgs     []string `mapstructure:"ovftool_args"`
+	OVFToolPath     string   `mapstructure:"ovftool_path"`
+	OutputDirectory string   `mapstructure:"output_directory"`
+
+	// Settings for disk images (from the QEMU and VirtualBox builders) that are converted to OVF.
+	QemuImgPath string `mapstructure:"qemu_img_path"`
+	CPUCount    int    `mapstructure:"cpu_count"`
+	MemoryGB    int    `mapstructure:"memory_gb"`
 }
 
 var _ helpers.PluginConfig = &Settings{}
@@ -44,6 +72,11 @@ func (settings *Settings) GetMCPPassword() string {
 	return settings.McpPassword
 }
 
+// GetTargetImageName retrieves the name of the customer image to create (including any suffix).
+func (settings *Settings) GetTargetImageName() string {
+	return settings.TargetImageName + settings.TargetImageSuffix
+}
+
 // Validate determines if the settings is valid.
 func (settings *Settings) Validate() (err error) {
 	if settings.McpRegion == "" {
@@ -84,8 +117,83 @@ func (settings *Settings) Validate() (err error) {
 		)
 	}
 	if settings.OVFPackagePrefix == "" {
-		settings.OVFPackagePrefix = settings.TargetImageName
+		settings.OVFPackagePrefix = settings.GetTargetImageName()
+	}
+	if settings.UploadParallelism == 0 {
+		settings.UploadParallelism = 2
+	} else if settings.UploadParallelism < 0 {
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("'upload_parallelism' cannot be negative"),
+		)
+	}
+	if settings.VirtualHardwareVersion != "" && !strings.HasPrefix(settings.VirtualHardwareVersion, "vmx-") {
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("'virtual_hardware_version' ('%s') must be a VMWare virtual hardware version (e.g. 'vmx-10')", settings.VirtualHardwareVersion),
+		)
+	}
+	if settings.DiskCompression == 0 {
+		settings.DiskCompression = 5
+	} else if settings.DiskCompression < 1 || settings.DiskCompression > 9 {
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("'disk_compression' must be between 1 (minimum compression) and 9 (maximum compression)"),
+		)
+	}
+	if settings.DiskMode == "" {
+		settings.DiskMode = "monolithicSparse"
+	} else if !isSupportedDiskMode(settings.DiskMode) {
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("'disk_mode' must be one of: %s", strings.Join(supportedDiskModes, ", ")),
+		)
+	}
+	if settings.OutputDirectory != "" {
+		if _, statErr := os.Stat(settings.OutputDirectory); statErr == nil {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("'output_directory' ('%s') already exists", settings.OutputDirectory),
+			)
+		}
+	}
+	if settings.CPUCount < 0 {
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("'cpu_count' cannot be negative"),
+		)
+	}
+	if settings.MemoryGB < 0 {
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("'memory_gb' cannot be negative"),
+		)
+	}
+	if settings.FTPSCACertFile != "" {
+		if _, statErr := os.Stat(settings.FTPSCACertFile); statErr != nil {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("'ftps_ca_cert_file' ('%s') cannot be accessed: %s", settings.FTPSCACertFile, statErr.Error()),
+			)
+		}
 	}
 
 	return
 }
+
+// The disk modes supported by ovftool.
+var supportedDiskModes = []string{
+	"monolithicSparse",
+	"monolithicFlat",
+	"twoGbMaxExtentSparse",
+	"twoGbMaxExtentFlat",
+	"seSparse",
+	"eagerZeroedThick",
+	"thin",
+	"thick",
+	"sparse",
+	"flat",
+}
+
+// Is the specified disk mode supported by ovftool?
+func isSupportedDiskMode(diskMode string) bool {
+	for _, supportedDiskMode := range supportedDiskModes {
+		if diskMode == supportedDiskMode {
+			return true
+		}
+	}
+
+	return false
+}
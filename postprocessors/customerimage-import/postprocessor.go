@@ -15,6 +15,11 @@ import (
 	confighelper "github.com/mitchellh/packer/helper/config"
 )
 
+// BuilderID is the unique Id for artifacts produced by the customer image import post-processor.
+//
+// This is the same Id used by the customer image builders, so the resulting artifact can be consumed by other ddcloud post-processors.
+const BuilderID = "ddcloud.image"
+
 // PostProcessor is the customer image import post-processor plugin for Packer.
 type PostProcessor struct {
 	settings             *config.Settings
@@ -64,17 +69,42 @@ func (postProcessor *PostProcessor) Configure(settings ...interface{}) (err erro
 				AsTarget:     true,
 			},
 			&steps.CheckTargetImage{
-				TargetImage: postProcessor.settings.TargetImageName,
+				TargetImage: postProcessor.settings.GetTargetImageName(),
+				Force:       postProcessor.settings.Force,
+			},
+			&steps.ExtractOVA{},
+			&steps.ConvertDiskImagesToOVF{
+				PackageName:       postProcessor.settings.OVFPackagePrefix,
+				OutputDir:         "",   // Create a new use new temporary directory
+				CleanupOVF:        true, // Delete once post-processor is done.
+				CPUCount:          postProcessor.settings.CPUCount,
+				MemoryGB:          postProcessor.settings.MemoryGB,
+				GuestOSType:       postProcessor.settings.GuestOSType,
+				QemuImgExecutable: postProcessor.settings.QemuImgPath,
 			},
 			&steps.ConvertVMXToOVF{
 				PackageName:     postProcessor.settings.OVFPackagePrefix,
-				OutputDir:       "",   // Create a new use new temporary directory
-				CleanupOVF:      true, // Delete once post-processor is done.
-				DiskCompression: 5,    // Hard-coded for now
+				OutputDir:       postProcessor.settings.OutputDirectory,       // If not specified, a new temporary directory is used.
+				CleanupOVF:      postProcessor.settings.OutputDirectory == "", // Only delete the temporary directory.
+				DiskCompression: postProcessor.settings.DiskCompression,
+				DiskMode:        postProcessor.settings.DiskMode,
+				ExtraArgs:       postProcessor.settings.OVFToolArgs,
+				OVFExecutable:   postProcessor.settings.OVFToolPath,
+			},
+			&steps.PrepareOVFManifest{},
+			&steps.RewriteOVFDescriptor{
+				GuestOSType:            postProcessor.settings.GuestOSType,
+				VirtualHardwareVersion: postProcessor.settings.VirtualHardwareVersion,
+			},
+			&steps.UploadOVFPackage{
+				FTPSCACertFile: postProcessor.settings.FTPSCACertFile,
+				FTPSSkipVerify: postProcessor.settings.FTPSSkipVerify,
+				Parallelism:    postProcessor.settings.UploadParallelism,
+				ResumeUploads:  postProcessor.settings.ResumeUpload,
+				KeepPackage:    postProcessor.settings.KeepOVFPackage,
 			},
-			&steps.UploadOVFPackage{},
 			&steps.ImportCustomerImage{
-				TargetImageName:  postProcessor.settings.TargetImageName,
+				TargetImageName:  postProcessor.settings.GetTargetImageName(),
 				DatacenterID:     postProcessor.settings.DatacenterID,
 				OVFPackagePrefix: postProcessor.settings.OVFPackagePrefix,
 			},
@@ -101,6 +131,7 @@ func (postProcessor *PostProcessor) PostProcess(ui packer.Ui, sourceArtifact pac
 	stepState.SetSettings(settings)
 	stepState.SetClient(client)
 	stepState.SetSourceArtifact(sourceArtifact)
+	stepState.SetBuilderID(BuilderID)
 	postProcessor.runner.Run(stepState.Data)
 
 	err = stepState.GetLastError()
@@ -108,8 +139,16 @@ func (postProcessor *PostProcessor) PostProcess(ui packer.Ui, sourceArtifact pac
 		return
 	}
 
-	// TODO: Use artifacts.Image.
-	destinationArtifact = stepState.GetRemoteOVFPackageArtifact()
+	imageArtifact := stepState.GetTargetImageArtifact()
+	if imageArtifact == nil {
+		err = fmt.Errorf("One or more steps failed to complete")
+
+		return
+	}
+	destinationArtifact = imageArtifact
+
+	// Packer will retain the source artifact if "keep_input_artifact" is true.
+	keep = false
 
 	return
 }
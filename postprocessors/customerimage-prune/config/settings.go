@@ -0,0 +1,123 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/helpers"
+	"github.com/mitchellh/packer/common"
+	"github.com/mitchellh/packer/helper/communicator"
+	"github.com/mitchellh/packer/packer"
+)
+
+// Settings represents the settings for the customer image prune post-processor.
+type Settings struct {
+	PackerConfig common.PackerConfig `mapstructure:",squash"`
+
+	McpRegion    string `mapstructure:"mcp_region"`
+	McpUser      string `mapstructure:"mcp_user"`
+	McpPassword  string `mapstructure:"mcp_password"`
+	DatacenterID string `mapstructure:"datacenter"`
+
+	NamePattern string `mapstructure:"name_pattern"`
+	ImageFamily string `mapstructure:"image_family"`
+	Keep        int    `mapstructure:"keep"`
+	DryRun      bool   `mapstructure:"dry_run"`
+}
+
+var _ helpers.PluginConfig = &Settings{}
+
+// GetPackerConfig retrieves the common Packer configuration for the plugin.
+func (settings *Settings) GetPackerConfig() *common.PackerConfig {
+	return &settings.PackerConfig
+}
+
+// GetCommunicatorConfig retrieves the Packer communicator configuration (if available) for the plugin.
+func (settings *Settings) GetCommunicatorConfig() *communicator.Config {
+	return nil
+}
+
+// GetMCPUser retrieves the Cloud Control user name.
+func (settings *Settings) GetMCPUser() string {
+	return settings.McpUser
+}
+
+// GetMCPPassword retrieves the Cloud Control password.
+func (settings *Settings) GetMCPPassword() string {
+	return settings.McpPassword
+}
+
+// GetNamePatternRegex compiles NamePattern (returns nil if NamePattern is not specified).
+//
+// The pattern is always matched against the whole image name (even if it contains alternatives such as "^a|b$").
+func (settings *Settings) GetNamePatternRegex() (*regexp.Regexp, error) {
+	if settings.NamePattern == "" {
+		return nil, nil
+	}
+
+	return regexp.Compile("^(?:" + settings.NamePattern + ")$")
+}
+
+// Validate determines if the settings is valid.
+func (settings *Settings) Validate() (err error) {
+	if settings.McpRegion == "" {
+		settings.McpRegion = os.Getenv("MCP_REGION")
+
+		if settings.McpRegion == "" {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("'mcp_region' has not been specified in settings and the MCP_REGION environment variable has not been set"),
+			)
+		}
+	}
+	if settings.McpUser == "" {
+		settings.McpUser = os.Getenv("MCP_USER")
+
+		if settings.McpUser == "" {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("'mcp_user' has not been specified in settings and the MCP_USER environment variable has not been set"),
+			)
+		}
+	}
+	if settings.McpPassword == "" {
+		settings.McpPassword = os.Getenv("MCP_PASSWORD")
+
+		if settings.McpPassword == "" {
+			err = packer.MultiErrorAppend(err,
+				fmt.Errorf("'mcp_password' has not been specified in settings and the MCP_PASSWORD environment variable has not been set"),
+			)
+		}
+	}
+	if settings.NamePattern == "" && settings.ImageFamily == "" {
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("Either 'name_pattern' or 'image_family' must be specified in settings"),
+		)
+	} else if settings.NamePattern != "" && settings.ImageFamily != "" {
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("Only one of 'name_pattern' or 'image_family' can be specified in settings"),
+		)
+	} else if settings.ImageFamily != "" && strings.TrimRight(settings.ImageFamily, "-_.") == "" {
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("'image_family' ('%s') must contain more than just separators", settings.ImageFamily),
+		)
+	} else if settings.NamePattern != "" && !(strings.HasPrefix(settings.NamePattern, "^") && strings.HasSuffix(settings.NamePattern, "$")) {
+		// An unanchored pattern could match unrelated images, which would then be deleted.
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("'name_pattern' ('%s') must be anchored (i.e. start with '^' and end with '$')", settings.NamePattern),
+		)
+	} else if _, regexError := settings.GetNamePatternRegex(); regexError != nil {
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("'name_pattern' ('%s') is not a valid regular expression: %s", settings.NamePattern, regexError.Error()),
+		)
+	}
+	if settings.Keep == 0 {
+		settings.Keep = 3
+	} else if settings.Keep < 1 {
+		err = packer.MultiErrorAppend(err,
+			fmt.Errorf("'keep' must be at least 1"),
+		)
+	}
+
+	return
+}
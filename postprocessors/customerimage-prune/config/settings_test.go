@@ -0,0 +1,106 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestSettingsValidate(test *testing.T) {
+	testCases := []struct {
+		name        string
+		namePattern string
+		imageFamily string
+		keep        int
+		expectError bool
+	}{
+		{name: "anchored name pattern", namePattern: `^base-\d+$`},
+		{name: "image family", imageFamily: "base"},
+		{name: "image family with separator", imageFamily: "base-"},
+		{name: "unanchored name pattern", namePattern: `base-\d+`, expectError: true},
+		{name: "name pattern without end anchor", namePattern: `^base-\d+`, expectError: true},
+		{name: "name pattern without start anchor", namePattern: `base-\d+$`, expectError: true},
+		{name: "invalid name pattern", namePattern: `^(base-\d+$`, expectError: true},
+		{name: "image family with only separators", imageFamily: "-_.", expectError: true},
+		{name: "neither name pattern nor image family", expectError: true},
+		{name: "both name pattern and image family", namePattern: `^base-\d+$`, imageFamily: "base", expectError: true},
+		{name: "negative keep", imageFamily: "base", keep: -1, expectError: true},
+	}
+
+	for _, testCase := range testCases {
+		settings := newTestSettings()
+		settings.NamePattern = testCase.namePattern
+		settings.ImageFamily = testCase.imageFamily
+		settings.Keep = testCase.keep
+
+		err := settings.Validate()
+		if testCase.expectError && err == nil {
+			test.Errorf("%s: expected an error", testCase.name)
+		}
+		if !testCase.expectError && err != nil {
+			test.Errorf("%s: unexpected error: %s", testCase.name, err.Error())
+		}
+	}
+}
+
+func TestSettingsValidateDefaultKeep(test *testing.T) {
+	settings := newTestSettings()
+	settings.ImageFamily = "base"
+
+	err := settings.Validate()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if settings.Keep != 3 {
+		test.Fatalf("keep is %d (expected 3)", settings.Keep)
+	}
+}
+
+func TestSettingsGetNamePatternRegex(test *testing.T) {
+	testCases := []struct {
+		namePattern string
+		imageName   string
+		matches     bool
+	}{
+		{`^base-\d+$`, "base-1", true},
+		{`^base-\d+$`, "base-1-copy", false},
+		{`^base-\d+$`, "my-base-1", false},
+
+		// Each alternative must match the whole name.
+		{`^base-\d+|web-\d+$`, "base-1", true},
+		{`^base-\d+|web-\d+$`, "web-1", true},
+		{`^base-\d+|web-\d+$`, "base-1-copy", false},
+		{`^base-\d+|web-\d+$`, "my-web-1", false},
+	}
+
+	for _, testCase := range testCases {
+		settings := &Settings{
+			NamePattern: testCase.namePattern,
+		}
+		namePattern, err := settings.GetNamePatternRegex()
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		if namePattern.MatchString(testCase.imageName) != testCase.matches {
+			test.Errorf("name pattern '%s', image '%s': matches is %t (expected %t)",
+				testCase.namePattern, testCase.imageName, !testCase.matches, testCase.matches,
+			)
+		}
+	}
+
+	settings := &Settings{}
+	namePattern, err := settings.GetNamePatternRegex()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if namePattern != nil {
+		test.Fatalf("name pattern is '%s' (expected nil)", namePattern)
+	}
+}
+
+func newTestSettings() *Settings {
+	return &Settings{
+		McpRegion:   "AU",
+		McpUser:     "user",
+		McpPassword: "password",
+	}
+}
@@ -8,8 +8,14 @@ import (
 )
 
 // CheckTargetImage is the step that ensures the target image does not already exist in CloudControl.
+//
+// If Force is true and the target image already exists, it is recorded in state data so that the CloneServer / ImportCustomerImage step
+// can replace it once the new image has been created (see createOrReplaceCustomerImage).
 type CheckTargetImage struct {
 	TargetImage string
+
+	// Replace the target image if it already exists?
+	Force bool
 }
 
 // Run is called to perform the step's action.
@@ -29,7 +35,11 @@ func (step *CheckTargetImage) Run(stateBag multistep.StateBag) multistep.StepAct
 		return multistep.ActionHalt
 	}
 
-	if targetImage != nil {
+	if targetImage == nil {
+		return multistep.ActionContinue
+	}
+
+	if !step.Force {
 		ui.Error(fmt.Sprintf(
 			"Target image '%s' already exists in datacenter '%s'.",
 			step.TargetImage,
@@ -39,6 +49,15 @@ func (step *CheckTargetImage) Run(stateBag multistep.StateBag) multistep.StepAct
 		return multistep.ActionHalt
 	}
 
+	ui.Message(fmt.Sprintf(
+		"Target image '%s' ('%s') already exists in datacenter '%s'; it will be replaced once the new image has been created.",
+		targetImage.Name,
+		targetImage.ID,
+		targetDatacenter.ID,
+	))
+
+	state.SetReplacedImage(targetImage)
+
 	return multistep.ActionContinue
 }
 
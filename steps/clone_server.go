@@ -12,6 +12,8 @@ import (
 )
 
 // CloneServer is the step that clones the target server in CloudControl.
+//
+// If the CheckTargetImage step found an existing image to replace, it is replaced (see createOrReplaceCustomerImage).
 type CloneServer struct{}
 
 // Run is called to perform the step's action.
@@ -60,35 +62,39 @@ func (step *CloneServer) Run(stateBag multistep.StateBag) multistep.StepAction {
 		server.ID,
 	))
 
-	ui.Message(fmt.Sprintf(
-		"Cloning server '%s' ('%s')...",
-		server.Name,
-		server.ID,
-	))
-
-	imageID, err := client.CloneServer(
-		server.ID,
-		settings.TargetImage,
-		fmt.Sprintf("%s (created by Packer)", settings.TargetImage),
-		false, // preventGuestOSCustomisation
-	)
+	customerImage, err := createOrReplaceCustomerImage(state, settings.GetTargetImageName(), func(imageName string) (*compute.CustomerImage, error) {
+		ui.Message(fmt.Sprintf(
+			"Cloning server '%s' ('%s') to customer image '%s'...",
+			server.Name,
+			server.ID,
+			imageName,
+		))
+
+		imageID, cloneError := client.CloneServer(
+			server.ID,
+			imageName,
+			fmt.Sprintf("%s (created by Packer)", imageName),
+			false, // preventGuestOSCustomisation
+		)
+		if cloneError != nil {
+			return nil, cloneError
+		}
+
+		clonedImage, cloneError := client.WaitForServerClone(
+			imageID,
+			15*time.Minute,
+		)
+		if cloneError != nil {
+			return nil, cloneError
+		}
+
+		return clonedImage.(*compute.CustomerImage), nil
+	})
 	if err != nil {
 		ui.Error(err.Error())
 
 		return multistep.ActionHalt
 	}
-
-	resource, err = client.WaitForServerClone(
-		imageID,
-		15*time.Minute,
-	)
-	if err != nil {
-		ui.Error(err.Error())
-
-		return multistep.ActionHalt
-	}
-
-	customerImage := resource.(*compute.CustomerImage)
 	state.SetTargetImage(customerImage)
 
 	ui.Message(fmt.Sprintf(
@@ -100,9 +106,11 @@ func (step *CloneServer) Run(stateBag multistep.StateBag) multistep.StepAction {
 		customerImage.DataCenterID,
 	))
 
-	imageArtifact := &artifacts.Image{
-		Image:     customerImage,
-		BuilderID: builderID,
+	imageArtifact := artifacts.NewImage(customerImage, builderID,
+		newCustomerImageDeleter(client, customerImage.ID),
+	)
+	if sourceImage := state.GetSourceImage(); sourceImage != nil {
+		imageArtifact.SourceImageID = sourceImage.GetID()
 	}
 	state.SetTargetImageArtifact(imageArtifact)
 
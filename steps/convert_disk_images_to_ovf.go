@@ -0,0 +1,442 @@
+package steps
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/artifacts"
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/helpers"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+)
+
+const (
+	// The builder Id for artifacts produced by Packer's QEMU builder.
+	qemuBuilderID = "transcend.qemu"
+
+	// The builder Id for artifacts produced by Packer's VirtualBox builders.
+	virtualBoxBuilderID = "mitchellh.virtualbox"
+)
+
+// ConvertDiskImagesToOVF is the step that converts the disk images from a QEMU (qcow2 / raw) or VirtualBox (.ovf + .vmdk) artifact
+// to an OVF package (for uploading to CloudControl).
+//
+// Each disk is converted to a stream-optimised VMDK using "qemu-img", and a new OVF descriptor is generated for the package.
+// If the source artifact was not produced by the QEMU or VirtualBox builders, this step does nothing.
+type ConvertDiskImagesToOVF struct {
+	// Delete the output directory (and its contents) when the Cleanup function is called?
+	CleanupOVF bool
+
+	// The base name for .ovf package files.
+	PackageName string
+
+	// The output directory for the OVF package files.
+	//
+	// If not specified, a new temporary directory will be created and used.
+	OutputDir string
+
+	// The number of CPUs for the virtual machine described by the generated OVF descriptor (defaults to 2).
+	CPUCount int
+
+	// The amount of memory (in GB) for the virtual machine described by the generated OVF descriptor (defaults to 4).
+	MemoryGB int
+
+	// The VMWare guest OS type for the virtual machine described by the generated OVF descriptor (defaults to "otherLinux64Guest").
+	GuestOSType string
+
+	// The path to the "qemu-img" executable.
+	QemuImgExecutable string
+}
+
+// Run is called to perform the step's action.
+//
+// The return value determines whether multi-step sequences should continue or halt.
+func (step *ConvertDiskImagesToOVF) Run(stateBag multistep.StateBag) multistep.StepAction {
+	state := helpers.ForStateBag(stateBag)
+	ui := state.GetUI()
+
+	if step.CPUCount < 1 {
+		step.CPUCount = 2
+	}
+	if step.MemoryGB < 1 {
+		step.MemoryGB = 4
+	}
+	if step.GuestOSType == "" {
+		step.GuestOSType = "otherLinux64Guest"
+	}
+	if step.QemuImgExecutable == "" {
+		step.QemuImgExecutable = "qemu-img"
+	}
+
+	sourceArtifact := state.GetSourceArtifact()
+	if sourceArtifact == nil {
+		state.ShowErrorMessage("Cannot find source artifact in state data.")
+
+		return multistep.ActionHalt
+	}
+
+	sourceDiskFiles := getSourceDiskImageFiles(sourceArtifact)
+	if sourceDiskFiles == nil {
+		return multistep.ActionContinue // Nothing to do.
+	}
+	if len(sourceDiskFiles) == 0 {
+		state.ShowErrorMessage("Cannot find any disk images in source artifact '%s' (of type '%s').",
+			sourceArtifact.Id(),
+			sourceArtifact.BuilderId(),
+		)
+
+		return multistep.ActionHalt
+	}
+	if len(sourceDiskFiles) > len(ovfSCSIUnitIDs) {
+		state.ShowErrorMessage("Source artifact '%s' has %d disk images (a maximum of %d are supported).",
+			sourceArtifact.Id(),
+			len(sourceDiskFiles),
+			len(ovfSCSIUnitIDs),
+		)
+
+		return multistep.ActionHalt
+	}
+
+	err := step.ensureOutputDirectory()
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+
+	qemuImg, err := helpers.ForTool(step.QemuImgExecutable, step.OutputDir, func(programOutput string) {
+		ui.Message(fmt.Sprintf(
+			"[qemu-img] %s",
+			programOutput,
+		))
+	})
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+
+	descriptor := &ovfDescriptor{
+		Name:        step.PackageName,
+		CPUCount:    step.CPUCount,
+		MemoryMB:    step.MemoryGB * 1024,
+		GuestOSType: step.GuestOSType,
+	}
+	for diskIndex, sourceDiskFile := range sourceDiskFiles {
+		diskFileName := fmt.Sprintf("%s-disk%d.vmdk", step.PackageName, diskIndex+1)
+		diskFile := path.Join(step.OutputDir, diskFileName)
+
+		ui.Message(fmt.Sprintf(
+			"Converting disk image '%s' to stream-optimised VMDK '%s'...",
+			sourceDiskFile,
+			diskFileName,
+		))
+
+		var success bool
+		success, err = qemuImg.Run(
+			"convert",
+			"-O", "vmdk", // To VMDK
+			"-o", "subformat=streamOptimized", // (as required by CloudControl)
+			sourceDiskFile, // From disk image
+			diskFile,       // To VMDK
+		)
+		if err != nil {
+			state.ShowError(err)
+
+			return multistep.ActionHalt
+		}
+		if !success {
+			state.ShowErrorMessage("qemu-img exit code does not indicate success")
+
+			return multistep.ActionHalt
+		}
+
+		var disk ovfDisk
+		disk, err = newOVFDisk(diskFile, diskIndex)
+		if err != nil {
+			state.ShowError(err)
+
+			return multistep.ActionHalt
+		}
+		descriptor.Disks = append(descriptor.Disks, disk)
+	}
+
+	ovfFile := path.Join(step.OutputDir, step.PackageName+".ovf")
+	err = descriptor.Write(ovfFile)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+
+	ui.Message(fmt.Sprintf(
+		"Generated OVF descriptor '%s'.",
+		ovfFile,
+	))
+
+	ovfArtifact, err := artifacts.NewFromFilesInLocalDirectory(step.OutputDir, "ddcloud.ovf")
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+	state.SetSourceArtifact(ovfArtifact)
+
+	return multistep.ActionContinue
+}
+
+// Cleanup is called in reverse order of the steps that have run
+// and allow steps to clean up after themselves. Do not assume if this
+// ran that the entire multi-step sequence completed successfully. This
+// method can be ran in the face of errors and cancellations as well.
+//
+// The parameter is the same "state bag" as Run, and represents the
+// state at the latest possible time prior to calling Cleanup.
+func (step *ConvertDiskImagesToOVF) Cleanup(stateBag multistep.StateBag) {
+	if !step.CleanupOVF {
+		return // No cleanup required.
+	}
+
+	state := helpers.ForStateBag(stateBag)
+
+	if step.OutputDir != "" {
+		err := os.RemoveAll(step.OutputDir)
+		if err != nil && !os.IsNotExist(err) {
+			state.SetLastError(err)
+			state.GetUI().Error(
+				err.Error(),
+			)
+		}
+
+		step.OutputDir = ""
+	}
+}
+
+var _ multistep.Step = &ConvertDiskImagesToOVF{}
+
+// Create the output directory (if required).
+func (step *ConvertDiskImagesToOVF) ensureOutputDirectory() (err error) {
+	if step.OutputDir == "" {
+		step.OutputDir, err = ioutil.TempDir(
+			"",                 // Use default temp directory
+			"packer_disk_ovf_", // Directory prefix
+		)
+
+		return
+	}
+
+	return os.MkdirAll(step.OutputDir, 0700 /* u=rwx */)
+}
+
+// Get the disk image files from a QEMU or VirtualBox artifact.
+//
+// Returns nil if the artifact was not produced by either of those builders.
+func getSourceDiskImageFiles(sourceArtifact packer.Artifact) (diskFiles []string) {
+	switch sourceArtifact.BuilderId() {
+	case qemuBuilderID:
+		// The QEMU builder's output directory only contains disk images.
+		diskFiles = []string{}
+		for _, sourceFile := range sourceArtifact.Files() {
+			diskFiles = append(diskFiles, sourceFile)
+		}
+	case virtualBoxBuilderID:
+		// Ignore VirtualBox's OVF descriptor (CloudControl will not accept it).
+		diskFiles = []string{}
+		for _, sourceFile := range sourceArtifact.Files() {
+			if strings.HasSuffix(sourceFile, ".vmdk") {
+				diskFiles = append(diskFiles, sourceFile)
+			}
+		}
+	}
+
+	for index, diskFile := range diskFiles {
+		absoluteDiskFile, err := filepath.Abs(diskFile)
+		if err == nil {
+			diskFiles[index] = absoluteDiskFile
+		}
+	}
+
+	return
+}
+
+// SCSI unit Ids for disks in a generated OVF descriptor (unit 7 is reserved for the controller).
+var ovfSCSIUnitIDs = []int{0, 1, 2, 3, 4, 5, 6, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// ovfDescriptor represents the information used to generate an OVF descriptor.
+type ovfDescriptor struct {
+	Name        string
+	CPUCount    int
+	MemoryMB    int
+	GuestOSType string
+	Disks       []ovfDisk
+}
+
+// ovfDisk represents a disk in a generated OVF descriptor.
+type ovfDisk struct {
+	ID            int
+	FileName      string
+	FileSize      int64
+	CapacityBytes int64
+	SCSIUnitID    int
+	InstanceID    int
+}
+
+// Create an ovfDisk for the specified stream-optimised VMDK file.
+func newOVFDisk(vmdkFile string, diskIndex int) (disk ovfDisk, err error) {
+	fileInfo, err := os.Stat(vmdkFile)
+	if err != nil {
+		return
+	}
+
+	capacityBytes, err := readVMDKCapacity(vmdkFile)
+	if err != nil {
+		return
+	}
+
+	disk = ovfDisk{
+		ID:            diskIndex + 1,
+		FileName:      path.Base(vmdkFile),
+		FileSize:      fileInfo.Size(),
+		CapacityBytes: capacityBytes,
+		SCSIUnitID:    ovfSCSIUnitIDs[diskIndex],
+		InstanceID:    5 + diskIndex, // After CPU, memory, SCSI controller, and network adapter.
+	}
+
+	return
+}
+
+// The header at the start of a sparse (e.g. stream-optimised) VMDK file.
+type vmdkSparseExtentHeader struct {
+	MagicNumber     uint32
+	Version         uint32
+	Flags           uint32
+	CapacitySectors uint64
+}
+
+// The magic number ("KDMV") that identifies a sparse VMDK file.
+const vmdkSparseMagicNumber = 0x564d444b
+
+// Read the (virtual) capacity, in bytes, of a sparse VMDK file.
+func readVMDKCapacity(vmdkFile string) (capacityBytes int64, err error) {
+	file, err := os.Open(vmdkFile)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var header vmdkSparseExtentHeader
+	err = binary.Read(file, binary.LittleEndian, &header)
+	if err != nil {
+		err = fmt.Errorf("Unable to read VMDK header from '%s': %s", vmdkFile, err.Error())
+
+		return
+	}
+	if header.MagicNumber != vmdkSparseMagicNumber {
+		err = fmt.Errorf("'%s' is not a sparse VMDK file", vmdkFile)
+
+		return
+	}
+
+	capacityBytes = int64(header.CapacitySectors) * 512
+
+	return
+}
+
+// Write the descriptor to the specified .ovf file.
+func (descriptor *ovfDescriptor) Write(ovfFile string) error {
+	file, err := os.Create(ovfFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return ovfDescriptorTemplate.Execute(file, descriptor)
+}
+
+var ovfDescriptorTemplate = template.Must(template.New("ovf").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<Envelope vmw:buildId="build-0" xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:cim="http://schemas.dmtf.org/wbem/wscim/1/common" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1" xmlns:rasd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData" xmlns:vmw="http://www.vmware.com/schema/ovf" xmlns:vssd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <References>
+{{- range .Disks}}
+    <File ovf:href="{{.FileName | html}}" ovf:id="file{{.ID}}" ovf:size="{{.FileSize}}"/>
+{{- end}}
+  </References>
+  <DiskSection>
+    <Info>Virtual disk information</Info>
+{{- range .Disks}}
+    <Disk ovf:capacity="{{.CapacityBytes}}" ovf:capacityAllocationUnits="byte" ovf:diskId="vmdisk{{.ID}}" ovf:fileRef="file{{.ID}}" ovf:format="http://www.vmware.com/interfaces/specifications/vmdk.html#streamOptimized"/>
+{{- end}}
+  </DiskSection>
+  <NetworkSection>
+    <Info>The list of logical networks</Info>
+    <Network ovf:name="VM Network">
+      <Description>The VM Network network</Description>
+    </Network>
+  </NetworkSection>
+  <VirtualSystem ovf:id="{{.Name | html}}">
+    <Info>A virtual machine</Info>
+    <Name>{{.Name | html}}</Name>
+    <OperatingSystemSection ovf:id="101" vmw:osType="{{.GuestOSType | html}}">
+      <Info>The kind of installed guest operating system</Info>
+    </OperatingSystemSection>
+    <VirtualHardwareSection>
+      <Info>Virtual hardware requirements</Info>
+      <System>
+        <vssd:ElementName>Virtual Hardware Family</vssd:ElementName>
+        <vssd:InstanceID>0</vssd:InstanceID>
+        <vssd:VirtualSystemIdentifier>{{.Name | html}}</vssd:VirtualSystemIdentifier>
+        <vssd:VirtualSystemType>vmx-10</vssd:VirtualSystemType>
+      </System>
+      <Item>
+        <rasd:AllocationUnits>hertz * 10^6</rasd:AllocationUnits>
+        <rasd:Description>Number of Virtual CPUs</rasd:Description>
+        <rasd:ElementName>{{.CPUCount}} virtual CPU(s)</rasd:ElementName>
+        <rasd:InstanceID>1</rasd:InstanceID>
+        <rasd:ResourceType>3</rasd:ResourceType>
+        <rasd:VirtualQuantity>{{.CPUCount}}</rasd:VirtualQuantity>
+      </Item>
+      <Item>
+        <rasd:AllocationUnits>byte * 2^20</rasd:AllocationUnits>
+        <rasd:Description>Memory Size</rasd:Description>
+        <rasd:ElementName>{{.MemoryMB}}MB of memory</rasd:ElementName>
+        <rasd:InstanceID>2</rasd:InstanceID>
+        <rasd:ResourceType>4</rasd:ResourceType>
+        <rasd:VirtualQuantity>{{.MemoryMB}}</rasd:VirtualQuantity>
+      </Item>
+      <Item>
+        <rasd:Address>0</rasd:Address>
+        <rasd:Description>SCSI Controller</rasd:Description>
+        <rasd:ElementName>SCSI controller 0</rasd:ElementName>
+        <rasd:InstanceID>3</rasd:InstanceID>
+        <rasd:ResourceSubType>lsilogic</rasd:ResourceSubType>
+        <rasd:ResourceType>6</rasd:ResourceType>
+      </Item>
+      <Item>
+        <rasd:AddressOnParent>0</rasd:AddressOnParent>
+        <rasd:AutomaticAllocation>true</rasd:AutomaticAllocation>
+        <rasd:Connection>VM Network</rasd:Connection>
+        <rasd:Description>VmxNet3 ethernet adapter on "VM Network"</rasd:Description>
+        <rasd:ElementName>Network adapter 1</rasd:ElementName>
+        <rasd:InstanceID>4</rasd:InstanceID>
+        <rasd:ResourceSubType>VmxNet3</rasd:ResourceSubType>
+        <rasd:ResourceType>10</rasd:ResourceType>
+      </Item>
+{{- range .Disks}}
+      <Item>
+        <rasd:AddressOnParent>{{.SCSIUnitID}}</rasd:AddressOnParent>
+        <rasd:ElementName>Hard disk {{.ID}}</rasd:ElementName>
+        <rasd:HostResource>ovf:/disk/vmdisk{{.ID}}</rasd:HostResource>
+        <rasd:InstanceID>{{.InstanceID}}</rasd:InstanceID>
+        <rasd:Parent>3</rasd:Parent>
+        <rasd:ResourceType>17</rasd:ResourceType>
+      </Item>
+{{- end}}
+    </VirtualHardwareSection>
+  </VirtualSystem>
+</Envelope>
+`))
@@ -2,10 +2,11 @@ package steps
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path"
-
-	"io/ioutil"
+	"path/filepath"
 
 	"github.com/DimensionDataResearch/packer-plugins-ddcloud/artifacts"
 	"github.com/DimensionDataResearch/packer-plugins-ddcloud/helpers"
@@ -13,7 +14,16 @@ import (
 	"github.com/mitchellh/packer/packer"
 )
 
+// The builder Id for artifacts produced by Packer's VMWare builders (vmware-iso and vmware-vmx).
+//
+// Artifacts built on a remote ESXi host ("mitchellh.vmware-esx") are not supported, since their files are not available locally.
+const vmwareBuilderID = "mitchellh.vmware"
+
 // ConvertVMXToOVF is the step that converts a .vmx artifact from the VMWare builder to a .ovf artifact (for uploading to CloudControl).
+//
+// Only artifacts from the (local) VMWare builders are converted. If the source artifact is from any other builder
+// and already contains an OVF package (e.g. extracted by the ExtractOVA step), no conversion is performed;
+// the package files are staged in the output directory, with the .ovf and .mf files renamed to match the package name.
 type ConvertVMXToOVF struct {
 	// Delete the output directory (and its contents) when the Cleanup function is called?
 	CleanupOVF bool
@@ -29,6 +39,12 @@ type ConvertVMXToOVF struct {
 	// The degree of disk compression (1-9, where 1 is minimum compression and 9 is maximum compression).
 	DiskCompression int
 
+	// The ovftool disk mode (defaults to "monolithicSparse").
+	DiskMode string
+
+	// Additional arguments to pass to ovftool.
+	ExtraArgs []string
+
 	// The path to the VMWare "ovftool" executable.
 	OVFExecutable string
 }
@@ -46,13 +62,40 @@ func (step *ConvertVMXToOVF) Run(stateBag multistep.StateBag) multistep.StepActi
 	if step.DiskCompression < 1 || step.DiskCompression > 9 {
 		step.DiskCompression = 1
 	}
+	if step.DiskMode == "" {
+		step.DiskMode = "monolithicSparse"
+	}
 
 	// Auto-detect tool location if not already specified.
 	if step.OVFExecutable == "" {
 		step.OVFExecutable = "ovftool"
 	}
 
-	vmxFile, err := step.getSourceVMXFile(state)
+	sourceArtifact := state.GetSourceArtifact()
+	if sourceArtifact == nil {
+		state.ShowErrorMessage("Cannot find source artifact in state data.")
+
+		return multistep.ActionHalt
+	}
+
+	sourceOVFFile := artifacts.GetFirstFileWithExtension(".ovf", sourceArtifact)
+	if sourceOVFFile != "" && sourceArtifact.BuilderId() != vmwareBuilderID {
+		ui.Message(fmt.Sprintf(
+			"Source artifact already contains OVF package '%s' (no conversion required).",
+			sourceOVFFile,
+		))
+
+		err = step.stageOVFPackage(sourceOVFFile, sourceArtifact)
+		if err != nil {
+			state.ShowError(err)
+
+			return multistep.ActionHalt
+		}
+
+		return step.setOVFArtifact(state)
+	}
+
+	vmxFile, err := step.getSourceVMXFile(sourceArtifact)
 	if err != nil {
 		state.ShowError(err)
 
@@ -73,12 +116,17 @@ func (step *ConvertVMXToOVF) Run(stateBag multistep.StateBag) multistep.StepActi
 		return multistep.ActionHalt
 	}
 
-	diskMode := "--diskMode=monolithicSparse"
-	success, err := ovfTool.Run(
-		diskMode, // VM disk format (single file, sparse)
-		vmxFile,  // From VMX
-		ovfFile,  // To OVF
+	ovfToolArgs := []string{
+		"--diskMode=" + step.DiskMode, // VM disk format
+		fmt.Sprintf("--compress=%d", step.DiskCompression),
+	}
+	ovfToolArgs = append(ovfToolArgs, step.ExtraArgs...)
+	ovfToolArgs = append(ovfToolArgs,
+		vmxFile, // From VMX
+		ovfFile, // To OVF
 	)
+
+	success, err := ovfTool.Run(ovfToolArgs...)
 	if err != nil {
 		state.ShowError(err)
 
@@ -91,15 +139,7 @@ func (step *ConvertVMXToOVF) Run(stateBag multistep.StateBag) multistep.StepActi
 		return multistep.ActionHalt
 	}
 
-	ovfArtifact, err := artifacts.NewFromFilesInLocalDirectory(step.OutputDir, "ddcloud.ovf")
-	if err != nil {
-		state.ShowError(err)
-
-		return multistep.ActionHalt
-	}
-	state.SetSourceArtifact(ovfArtifact)
-
-	return multistep.ActionContinue
+	return step.setOVFArtifact(state)
 }
 
 // Cleanup is called in reverse order of the steps that have run
@@ -129,6 +169,21 @@ func (step *ConvertVMXToOVF) Cleanup(stateBag multistep.StateBag) {
 	}
 }
 
+var _ multistep.Step = &ConvertVMXToOVF{}
+
+// Replace the source artifact (in state data) with one representing the OVF package files in the output directory.
+func (step *ConvertVMXToOVF) setOVFArtifact(state helpers.State) multistep.StepAction {
+	ovfArtifact, err := artifacts.NewFromFilesInLocalDirectory(step.OutputDir, "ddcloud.ovf")
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+	state.SetSourceArtifact(ovfArtifact)
+
+	return multistep.ActionContinue
+}
+
 // Verify that the output directory has been configured and does not yet exist.
 func (step *ConvertVMXToOVF) ensureOutputDirectory() (err error) {
 	if step.OutputDir == "" {
@@ -142,7 +197,7 @@ func (step *ConvertVMXToOVF) ensureOutputDirectory() (err error) {
 	} else {
 		// Verify that target directory does not exist.
 		_, err = os.Stat(step.OutputDir)
-		if err != nil && !os.IsNotExist(err) {
+		if err == nil {
 			err = fmt.Errorf(
 				"Output directory '%s' already exists",
 				step.OutputDir,
@@ -150,6 +205,9 @@ func (step *ConvertVMXToOVF) ensureOutputDirectory() (err error) {
 
 			return
 		}
+		if !os.IsNotExist(err) {
+			return
+		}
 
 		err = os.MkdirAll(step.OutputDir, 0700 /* u=rwx */)
 		if err != nil {
@@ -160,22 +218,14 @@ func (step *ConvertVMXToOVF) ensureOutputDirectory() (err error) {
 	return
 }
 
-// Retrieve the .vmx file path from the source artifact in state data.
-func (step *ConvertVMXToOVF) getSourceVMXFile(state helpers.State) (vmxFilePath string, err error) {
-	sourceArtifact := state.GetSourceArtifact()
-	if sourceArtifact == nil {
+// Retrieve the .vmx file path from the source artifact.
+func (step *ConvertVMXToOVF) getSourceVMXFile(sourceArtifact packer.Artifact) (vmxFilePath string, err error) {
+	if sourceArtifact.BuilderId() != vmwareBuilderID {
 		err = fmt.Errorf(
-			"Cannot find source artifact in state data.",
-		)
-
-		return
-	}
-
-	if sourceArtifact.BuilderId() != "mitchellh.vmware" {
-		err = fmt.Errorf(
-			"Source artifact '%s' is of type '%s' (expected 'mitchellh.vmware').",
+			"Source artifact '%s' is of type '%s' (expected '%s'), and does not contain a .ovf or .ova file.",
 			sourceArtifact.Id(),
 			sourceArtifact.BuilderId(),
+			vmwareBuilderID,
 		)
 
 		return
@@ -191,12 +241,97 @@ func (step *ConvertVMXToOVF) getSourceVMXFile(state helpers.State) (vmxFilePath
 		return
 	}
 
-	currentDir, _ := os.Getwd()
-	vmxFilePath = path.Join(currentDir, vmxFilePath)
+	vmxFilePath, err = filepath.Abs(vmxFilePath)
 
 	return
 }
 
+// Stage the files from an existing OVF package in the output directory.
+//
+// The .ovf and .mf files are renamed to match the package name (CloudControl requires this), and the manifest is updated accordingly.
+func (step *ConvertVMXToOVF) stageOVFPackage(sourceOVFFile string, sourceArtifact packer.Artifact) error {
+	targetOVFFile, err := step.getTargetOVFFile()
+	if err != nil {
+		return err
+	}
+
+	sourceOVFFileName := path.Base(sourceOVFFile)
+	targetOVFFileName := path.Base(targetOVFFile)
+
+	for _, sourceFile := range sourceArtifact.Files() {
+		if !isOVFPackageFile(sourceFile) {
+			continue
+		}
+
+		sourceFile, err = filepath.Abs(sourceFile)
+		if err != nil {
+			return err
+		}
+
+		switch path.Ext(sourceFile) {
+		case ".ovf":
+			if path.Base(sourceFile) != sourceOVFFileName {
+				return fmt.Errorf("Source artifact '%s' contains more than one .ovf file", sourceArtifact.Id())
+			}
+
+			err = copyFile(sourceFile, targetOVFFile)
+		case ".mf":
+			var manifest *helpers.OVFManifest
+			manifest, err = helpers.ReadOVFManifest(sourceFile)
+			if err != nil {
+				return err
+			}
+
+			ovfEntry := manifest.GetEntry(sourceOVFFileName)
+			if ovfEntry != nil {
+				ovfEntry.FileName = targetOVFFileName
+			}
+
+			err = manifest.Write(
+				path.Join(step.OutputDir, step.PackageName+".mf"),
+			)
+		default:
+			err = linkOrCopyFile(sourceFile,
+				path.Join(step.OutputDir, path.Base(sourceFile)),
+			)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Hard-link a file to a new location (or, if that's not possible, copy it).
+func linkOrCopyFile(sourceFile string, targetFile string) error {
+	err := os.Link(sourceFile, targetFile)
+	if err == nil {
+		return nil
+	}
+
+	return copyFile(sourceFile, targetFile)
+}
+
+// Copy a file to a new location.
+func copyFile(sourceFile string, targetFile string) error {
+	source, err := os.Open(sourceFile)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	target, err := os.Create(targetFile)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	_, err = io.Copy(target, source)
+
+	return err
+}
+
 // Get the target .ovf file path.
 func (step *ConvertVMXToOVF) getTargetOVFFile() (targetOVFFile string, err error) {
 	err = step.ensureOutputDirectory()
@@ -36,7 +36,7 @@ func (step *CreateFirewallRule) Run(stateBag multistep.StateBag) multistep.StepA
 		return multistep.ActionContinue
 	}
 
-	if settings.CommunicatorConfig.Type == "" {
+	if settings.CommunicatorConfig.Type == "" || settings.CommunicatorConfig.Type == "none" {
 		ui.Message(fmt.Sprintf(
 			"Server '%s' will not be exposed because no communicator is configured.",
 			server.Name,
@@ -45,50 +45,37 @@ func (step *CreateFirewallRule) Run(stateBag multistep.StateBag) multistep.StepA
 		return multistep.ActionContinue
 	}
 
-	ui.Message(fmt.Sprintf(
-		"Creating firewall rule to permit access for server '%s' ('%s') via public IPv4 address '%s'...",
-		server.Name,
-		server.ID,
-		natRule.ExternalIPAddress,
-	))
+	ports := []int{settings.GetCommunicatorPort()}
+	ports = append(ports, settings.FirewallExtraPorts...)
 
-	firewallRuleConfiguration := &compute.FirewallRuleConfiguration{
-		Name:            fmt.Sprintf("packer.%s.inbound", settings.UniquenessKey),
-		NetworkDomainID: networkDomain.ID,
-	}
-	firewallRuleConfiguration.Accept()
-	firewallRuleConfiguration.IPv4()
-	firewallRuleConfiguration.IP()
-	firewallRuleConfiguration.MatchSourceAddress(settings.ClientIP)
-	firewallRuleConfiguration.MatchDestinationAddress(natRule.ExternalIPAddress)
-	firewallRuleConfiguration.PlaceFirst()
-	firewallRuleConfiguration.Enable()
+	var firewallRules []*compute.FirewallRule
+	for index, port := range ports {
+		ruleName := fmt.Sprintf("packer.%s.inbound", settings.UniquenessKey)
+		if index > 0 {
+			ruleName = fmt.Sprintf("%s.%d", ruleName, port)
+		}
 
-	firewallRuleID, err := client.CreateFirewallRule(*firewallRuleConfiguration)
-	if err != nil {
-		ui.Error(err.Error())
-
-		return multistep.ActionHalt
-	}
-
-	firewallRule, err := client.GetFirewallRule(firewallRuleID)
-	if err != nil {
-		ui.Error(err.Error())
+		ui.Message(fmt.Sprintf(
+			"Creating firewall rule '%s' to permit access to TCP port %d for server '%s' ('%s') via public IPv4 address '%s'...",
+			ruleName,
+			port,
+			server.Name,
+			server.ID,
+			natRule.ExternalIPAddress,
+		))
 
-		return multistep.ActionHalt
-	}
+		firewallRule, err := step.createFirewallRule(client, settings, networkDomain.ID, ruleName, natRule.ExternalIPAddress, port)
+		if err != nil {
+			ui.Error(err.Error())
 
-	if firewallRule == nil {
-		ui.Error(fmt.Sprintf(
-			"Cannot find newly-created firewall rule '%s'.",
-			firewallRuleID,
-		))
+			return multistep.ActionHalt
+		}
 
-		return multistep.ActionHalt
+		// Track each rule as soon as it's created so that Cleanup can remove it.
+		firewallRules = append(firewallRules, firewallRule)
+		state.SetFirewallRules(firewallRules)
 	}
 
-	state.SetFirewallRule(firewallRule)
-
 	return multistep.ActionContinue
 }
 
@@ -107,35 +94,85 @@ func (step *CreateFirewallRule) Cleanup(stateBag multistep.StateBag) {
 	client := state.GetClient()
 	server := state.GetServer()
 
-	firewallRule := state.GetFirewallRule()
-	if settings.UsePrivateIPv4 || firewallRule == nil {
+	firewallRules := state.GetFirewallRules()
+	if settings.UsePrivateIPv4 || len(firewallRules) == 0 {
 		return // Nothing to do.
 	}
 
-	ui.Message(fmt.Sprintf(
-		"Destroying firewall rule '%s' ('%s') for server '%s' ('%s')...",
-		firewallRule.Name,
-		firewallRule.ID,
-		server.Name,
-		server.ID,
-	))
-
-	err := client.DeleteFirewallRule(firewallRule.ID)
-	if err != nil {
-		ui.Error(err.Error())
-
+	if shouldRetainBuildResources(state) {
 		return
 	}
 
-	state.SetFirewallRule(nil)
+	var remainingFirewallRules []*compute.FirewallRule
+	for _, firewallRule := range firewallRules {
+		ui.Message(fmt.Sprintf(
+			"Destroying firewall rule '%s' ('%s') for server '%s' ('%s')...",
+			firewallRule.Name,
+			firewallRule.ID,
+			server.Name,
+			server.ID,
+		))
+
+		err := client.DeleteFirewallRule(firewallRule.ID)
+		if err != nil {
+			ui.Error(err.Error())
 
-	ui.Message(fmt.Sprintf(
-		"Destroyed firewall rule '%s' ('%s') for server '%s' ('%s').",
-		firewallRule.Name,
-		firewallRule.ID,
-		server.Name,
-		server.ID,
-	))
+			remainingFirewallRules = append(remainingFirewallRules, firewallRule)
+
+			continue
+		}
+
+		ui.Message(fmt.Sprintf(
+			"Destroyed firewall rule '%s' ('%s') for server '%s' ('%s').",
+			firewallRule.Name,
+			firewallRule.ID,
+			server.Name,
+			server.ID,
+		))
+	}
+
+	state.SetFirewallRules(remainingFirewallRules)
 }
 
 var _ multistep.Step = &CreateFirewallRule{}
+
+// Create a firewall rule that permits TCP traffic from the client IP to the specified port on the server's public IPv4 address.
+func (step *CreateFirewallRule) createFirewallRule(client *compute.Client, settings *config.Settings, networkDomainID string, ruleName string, externalIPAddress string, port int) (*compute.FirewallRule, error) {
+	firewallRuleConfiguration := &compute.FirewallRuleConfiguration{
+		Name:            ruleName,
+		NetworkDomainID: networkDomainID,
+	}
+	firewallRuleConfiguration.Accept()
+	firewallRuleConfiguration.IPv4()
+	firewallRuleConfiguration.TCP()
+	firewallRuleConfiguration.MatchSourceAddress(settings.ClientIP)
+	firewallRuleConfiguration.MatchDestinationAddress(externalIPAddress)
+	firewallRuleConfiguration.MatchDestinationPort(port)
+	switch settings.FirewallRulePlacement {
+	case "before":
+		firewallRuleConfiguration.PlaceBefore(settings.FirewallRuleRelativeTo)
+	case "after":
+		firewallRuleConfiguration.PlaceAfter(settings.FirewallRuleRelativeTo)
+	default:
+		firewallRuleConfiguration.PlaceFirst()
+	}
+	firewallRuleConfiguration.Enable()
+
+	firewallRuleID, err := client.CreateFirewallRule(*firewallRuleConfiguration)
+	if err != nil {
+		return nil, err
+	}
+
+	firewallRule, err := client.GetFirewallRule(firewallRuleID)
+	if err != nil {
+		return nil, err
+	}
+	if firewallRule == nil {
+		return nil, fmt.Errorf(
+			"Cannot find newly-created firewall rule '%s'.",
+			firewallRuleID,
+		)
+	}
+
+	return firewallRule, nil
+}
@@ -34,7 +34,7 @@ func (step *CreateNATRule) Run(stateBag multistep.StateBag) multistep.StepAction
 		return multistep.ActionContinue
 	}
 
-	if settings.CommunicatorConfig.Type == "" {
+	if settings.CommunicatorConfig.Type == "" || settings.CommunicatorConfig.Type == "none" {
 		ui.Message(fmt.Sprintf(
 			"Server '%s' will not be exposed because no communicator is configured.",
 			server.Name,
@@ -58,6 +58,16 @@ func (step *CreateNATRule) Run(stateBag multistep.StateBag) multistep.StepAction
 	)
 	if err != nil {
 		if compute.IsNoIPAddressAvailableError(err) {
+			if settings.RequireExistingPublicIP {
+				ui.Error(fmt.Sprintf(
+					"Network domain '%s' ('%s') has no public IP addresses available, and the configuration specifies 'require_existing_public_ip'.",
+					networkDomain.Name,
+					networkDomain.ID,
+				))
+
+				return multistep.ActionHalt
+			}
+
 			ui.Message(fmt.Sprintf(
 				"Network domain '%s' ('%s') has no public IP addresses available; a new block will now be allocated...",
 				networkDomain.Name,
@@ -71,6 +81,9 @@ func (step *CreateNATRule) Run(stateBag multistep.StateBag) multistep.StepAction
 				return multistep.ActionHalt
 			}
 
+			// Track the block so that Cleanup can release it.
+			state.SetAllocatedPublicIPBlockID(publicIPBlockID)
+
 			ui.Message(fmt.Sprintf(
 				"Allocated new public IP block '%s' in network domain '%s' ('%s').",
 				publicIPBlockID,
@@ -150,6 +163,13 @@ func (step *CreateNATRule) Cleanup(stateBag multistep.StateBag) {
 	client := state.GetClient()
 	server := state.GetServer()
 
+	if shouldRetainBuildResources(state) {
+		return
+	}
+
+	// Release the public IP block (if any) once the NAT rule is gone.
+	defer step.releasePublicIPBlock(state)
+
 	natRule := state.GetNATRule()
 	if natRule == nil {
 		return // Nothing to do.
@@ -184,3 +204,65 @@ func (step *CreateNATRule) Cleanup(stateBag multistep.StateBag) {
 }
 
 var _ multistep.Step = &CreateNATRule{}
+
+// Release the public IP block (if any) that was allocated by the build, as long as none of its addresses are still in use.
+func (step *CreateNATRule) releasePublicIPBlock(state helpers.State) {
+	ui := state.GetUI()
+
+	client := state.GetClient()
+	networkDomain := state.GetNetworkDomain()
+
+	publicIPBlockID := state.GetAllocatedPublicIPBlockID()
+	if publicIPBlockID == "" {
+		return // Nothing to do.
+	}
+
+	if state.GetNATRule() != nil {
+		ui.Error(fmt.Sprintf(
+			"Not releasing public IP block '%s' because the NAT rule that uses it could not be destroyed.",
+			publicIPBlockID,
+		))
+
+		return
+	}
+
+	inUse, err := helpers.IsPublicIPBlockInUse(client, networkDomain.ID, publicIPBlockID)
+	if err != nil {
+		ui.Error(err.Error())
+
+		return
+	}
+	if inUse {
+		ui.Message(fmt.Sprintf(
+			"Not releasing public IP block '%s' in network domain '%s' ('%s') because one or more of its addresses are still in use.",
+			publicIPBlockID,
+			networkDomain.Name,
+			networkDomain.ID,
+		))
+
+		return
+	}
+
+	ui.Message(fmt.Sprintf(
+		"Releasing public IP block '%s' in network domain '%s' ('%s')...",
+		publicIPBlockID,
+		networkDomain.Name,
+		networkDomain.ID,
+	))
+
+	err = client.RemovePublicIPBlock(publicIPBlockID)
+	if err != nil {
+		ui.Error(err.Error())
+
+		return
+	}
+
+	state.SetAllocatedPublicIPBlockID("")
+
+	ui.Message(fmt.Sprintf(
+		"Released public IP block '%s' in network domain '%s' ('%s').",
+		publicIPBlockID,
+		networkDomain.Name,
+		networkDomain.ID,
+	))
+}
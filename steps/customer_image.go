@@ -0,0 +1,136 @@
+package steps
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/DimensionDataResearch/go-dd-cloud-compute/compute"
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/artifacts"
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/helpers"
+)
+
+// imagesByCreateTime sorts OS and customer images by creation time (oldest first).
+type imagesByCreateTime []compute.Image
+
+func (images imagesByCreateTime) Len() int {
+	return len(images)
+}
+
+func (images imagesByCreateTime) Less(index1 int, index2 int) bool {
+	return artifacts.GetImageCreateTime(images[index1]) < artifacts.GetImageCreateTime(images[index2])
+}
+
+func (images imagesByCreateTime) Swap(index1 int, index2 int) {
+	images[index1], images[index2] = images[index2], images[index1]
+}
+
+// Create a function that deletes the specified customer image (and waits for the deletion to complete).
+//
+// Used as the delete function for image artifacts, so that the image is deleted when Packer destroys the artifact.
+func newCustomerImageDeleter(client *compute.Client, imageID string) func() error {
+	return func() error {
+		log.Printf("Deleting customer image '%s'...", imageID)
+
+		err := client.DeleteCustomerImage(imageID)
+		if err != nil {
+			return err
+		}
+
+		err = client.WaitForDelete(compute.ResourceTypeCustomerImage, imageID, 15*time.Minute)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Deleted customer image '%s'.", imageID)
+
+		return nil
+	}
+}
+
+// Create the target customer image (using createImage), replacing the existing image (if any) recorded by the CheckTargetImage step.
+//
+// When replacing an existing image, the new image is first created under a temporary name ("<target>.packer-<key>"),
+// and the existing image is only deleted once that has succeeded (so a failed build never loses the existing image).
+// CloudControl does not permit 2 images with the same name, and customer images cannot be renamed, so createImage is then called
+// again to create the image under the target name, and the temporary image is deleted.
+// If that second call fails, the temporary image is retained (and reported in the error).
+func createOrReplaceCustomerImage(state helpers.State, targetImageName string, createImage func(imageName string) (*compute.CustomerImage, error)) (*compute.CustomerImage, error) {
+	ui := state.GetUI()
+	client := state.GetClient()
+
+	replacedImage := state.GetReplacedImage()
+	if replacedImage == nil {
+		return createImage(targetImageName)
+	}
+
+	temporaryKeyBytes := make([]byte, 5)
+	rand.Read(temporaryKeyBytes)
+	temporaryImageName := fmt.Sprintf("%s.packer-%s", targetImageName, hex.EncodeToString(temporaryKeyBytes))
+
+	ui.Message(fmt.Sprintf(
+		"Creating new image as '%s' (existing image '%s' will be replaced once it has been created)...",
+		temporaryImageName,
+		replacedImage.Name,
+	))
+
+	temporaryImage, err := createImage(temporaryImageName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create new image '%s' (existing image '%s' has been retained): %s",
+			temporaryImageName,
+			replacedImage.Name,
+			err.Error(),
+		)
+	}
+
+	ui.Message(fmt.Sprintf(
+		"Deleting existing image '%s' ('%s')...",
+		replacedImage.Name,
+		replacedImage.ID,
+	))
+
+	err = newCustomerImageDeleter(client, replacedImage.ID)()
+	if err != nil {
+		deleteError := newCustomerImageDeleter(client, temporaryImage.ID)()
+		if deleteError != nil {
+			ui.Error(deleteError.Error())
+		}
+
+		return nil, fmt.Errorf("Failed to delete existing image '%s' ('%s'): %s",
+			replacedImage.Name,
+			replacedImage.ID,
+			err.Error(),
+		)
+	}
+
+	ui.Message(fmt.Sprintf(
+		"Deleted existing image '%s'; creating new image as '%s'...",
+		replacedImage.Name,
+		targetImageName,
+	))
+
+	targetImage, err := createImage(targetImageName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create image '%s' (the new image is still available as '%s' ('%s')): %s",
+			targetImageName,
+			temporaryImage.Name,
+			temporaryImage.ID,
+			err.Error(),
+		)
+	}
+
+	err = newCustomerImageDeleter(client, temporaryImage.ID)()
+	if err != nil {
+		// Not fatal; the target image has been created.
+		ui.Error(fmt.Sprintf(
+			"Failed to delete temporary image '%s' ('%s'): %s",
+			temporaryImage.Name,
+			temporaryImage.ID,
+			err.Error(),
+		))
+	}
+
+	return targetImage, nil
+}
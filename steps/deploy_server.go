@@ -43,7 +43,7 @@ func (step *DeployServer) Run(stateBag multistep.StateBag) multistep.StepAction
 
 		deploymentConfiguration := compute.ServerDeploymentConfiguration{
 			Name:                  settings.ServerName,
-			Description:           fmt.Sprintf("Temporary server created by Packer for image '%s'", settings.TargetImage),
+			Description:           fmt.Sprintf("Temporary server created by Packer for image '%s'", settings.GetTargetImageName()),
 			AdministratorPassword: settings.InitialAdminPassword,
 			Network: compute.VirtualMachineNetwork{
 				NetworkDomainID: networkDomain.ID,
@@ -54,6 +54,11 @@ func (step *DeployServer) Run(stateBag multistep.StateBag) multistep.StepAction
 			Start: true, // TODO: Is it possible to auto-start the server only when one or more provisioners are configured?
 		}
 		image.ApplyTo(&deploymentConfiguration)
+		step.applyHardwareSettings(settings,
+			&deploymentConfiguration.CPU,
+			&deploymentConfiguration.MemoryGB,
+			deploymentConfiguration.Disks,
+		)
 
 		serverID, err = client.DeployServer(deploymentConfiguration)
 		if err != nil {
@@ -71,7 +76,7 @@ func (step *DeployServer) Run(stateBag multistep.StateBag) multistep.StepAction
 
 		deploymentConfiguration := compute.UncustomizedServerDeploymentConfiguration{
 			Name:        settings.ServerName,
-			Description: fmt.Sprintf("Temporary server created by Packer for image '%s'", settings.TargetImage),
+			Description: fmt.Sprintf("Temporary server created by Packer for image '%s'", settings.GetTargetImageName()),
 			Network: compute.VirtualMachineNetwork{
 				NetworkDomainID: networkDomain.ID,
 				PrimaryAdapter: compute.VirtualMachineNetworkAdapter{
@@ -81,6 +86,11 @@ func (step *DeployServer) Run(stateBag multistep.StateBag) multistep.StepAction
 			Start: true, // TODO: Is it possible to auto-start the server only when one or more provisioners are configured?
 		}
 		image.ApplyToUncustomized(&deploymentConfiguration)
+		step.applyHardwareSettings(settings,
+			&deploymentConfiguration.CPU,
+			&deploymentConfiguration.MemoryGB,
+			deploymentConfiguration.Disks,
+		)
 
 		serverID, err = client.DeployUncustomizedServer(deploymentConfiguration)
 		if err != nil {
@@ -100,6 +110,14 @@ func (step *DeployServer) Run(stateBag multistep.StateBag) multistep.StepAction
 	server := resource.(*compute.Server)
 	state.SetServer(server)
 
+	server, err = step.configureDisks(settings, client, server, ui)
+	if err != nil {
+		ui.Error(err.Error())
+
+		return multistep.ActionHalt
+	}
+	state.SetServer(server)
+
 	serverIPv4 := *server.Network.PrimaryAdapter.PrivateIPv4Address
 	ui.Message(fmt.Sprintf(
 		"Server '%s' has IPv4 address '%s'.",
@@ -127,11 +145,19 @@ func (step *DeployServer) Run(stateBag multistep.StateBag) multistep.StepAction
 //
 // The parameter is the same "state bag" as Run, and represents the
 // state at the latest possible time prior to calling Cleanup.
-func (step *DeployServer) Cleanup(state multistep.StateBag) {
-	ui := state.Get("ui").(packer.Ui)
+func (step *DeployServer) Cleanup(stateBag multistep.StateBag) {
+	state := helpers.ForStateBag(stateBag)
+	ui := state.GetUI()
 
-	client := state.Get("client").(*compute.Client)
-	server := state.Get("server").(*compute.Server)
+	client := state.GetClient()
+	server := state.GetServer()
+	if server == nil {
+		return // Nothing to do.
+	}
+
+	if shouldRetainBuildResources(state) {
+		return
+	}
 
 	ui.Message(fmt.Sprintf(
 		"Destroying server '%s' ('%s')...",
@@ -205,3 +231,121 @@ func (step *DeployServer) Cleanup(state multistep.StateBag) {
 }
 
 var _ multistep.Step = &DeployServer{}
+
+// Apply the configured CPU, memory, and disk speed settings (if any) to a server deployment configuration.
+func (step *DeployServer) applyHardwareSettings(settings *config.Settings, cpu *compute.VirtualMachineCPU, memoryGB *int, disks []compute.VirtualMachineDisk) {
+	if settings.CPUCount > 0 {
+		cpu.Count = settings.CPUCount
+	}
+	if settings.CPUCoresPerSocket > 0 {
+		cpu.CoresPerSocket = settings.CPUCoresPerSocket
+	}
+	if settings.CPUSpeed != "" {
+		cpu.Speed = settings.CPUSpeed
+	}
+	if settings.MemoryGB > 0 {
+		*memoryGB = settings.MemoryGB
+	}
+
+	// Disk speed (but not size) can be specified when the server is deployed.
+	for index := range disks {
+		disk := &disks[index]
+
+		for _, diskSettings := range settings.Disks {
+			if diskSettings.SCSIUnitID == disk.SCSIUnitID {
+				disk.Speed = diskSettings.Speed
+			}
+		}
+	}
+}
+
+// Resize existing disks and add new disks, as specified by the configured disk settings.
+func (step *DeployServer) configureDisks(settings *config.Settings, client *compute.Client, server *compute.Server, ui packer.Ui) (*compute.Server, error) {
+	for _, diskSettings := range settings.Disks {
+		var existingDisk *compute.VirtualMachineDisk
+		for index := range server.Disks {
+			if server.Disks[index].SCSIUnitID == diskSettings.SCSIUnitID {
+				existingDisk = &server.Disks[index]
+
+				break
+			}
+		}
+
+		if existingDisk != nil {
+			if diskSettings.SizeGB == 0 || diskSettings.SizeGB == existingDisk.SizeGB {
+				continue // Nothing to do.
+			}
+			if diskSettings.SizeGB < existingDisk.SizeGB {
+				return server, fmt.Errorf(
+					"Cannot shrink disk with SCSI unit Id %d on server '%s' ('%s') from %dGB to %dGB.",
+					diskSettings.SCSIUnitID,
+					server.Name,
+					server.ID,
+					existingDisk.SizeGB,
+					diskSettings.SizeGB,
+				)
+			}
+
+			ui.Message(fmt.Sprintf(
+				"Resizing disk with SCSI unit Id %d on server '%s' ('%s') from %dGB to %dGB...",
+				diskSettings.SCSIUnitID,
+				server.Name,
+				server.ID,
+				existingDisk.SizeGB,
+				diskSettings.SizeGB,
+			))
+
+			_, err := client.ResizeServerDisk(server.ID, *existingDisk.ID, diskSettings.SizeGB)
+			if err != nil {
+				return server, err
+			}
+
+			_, err = client.WaitForChange(compute.ResourceTypeServer, server.ID, "Resize disk", 10*time.Minute)
+			if err != nil {
+				return server, err
+			}
+		} else {
+			if diskSettings.SizeGB == 0 {
+				return server, fmt.Errorf(
+					"Server '%s' ('%s') has no disk with SCSI unit Id %d, and no size was specified for a new disk.",
+					server.Name,
+					server.ID,
+					diskSettings.SCSIUnitID,
+				)
+			}
+
+			ui.Message(fmt.Sprintf(
+				"Adding %dGB %s disk with SCSI unit Id %d to server '%s' ('%s')...",
+				diskSettings.SizeGB,
+				diskSettings.Speed,
+				diskSettings.SCSIUnitID,
+				server.Name,
+				server.ID,
+			))
+
+			_, err := client.AddDiskToServer(server.ID, diskSettings.SCSIUnitID, diskSettings.SizeGB, diskSettings.Speed)
+			if err != nil {
+				return server, err
+			}
+
+			_, err = client.WaitForChange(compute.ResourceTypeServer, server.ID, "Add disk", 10*time.Minute)
+			if err != nil {
+				return server, err
+			}
+		}
+	}
+
+	if len(settings.Disks) == 0 {
+		return server, nil
+	}
+
+	updatedServer, err := client.GetServer(server.ID)
+	if err != nil {
+		return server, err
+	}
+	if updatedServer == nil {
+		return server, fmt.Errorf("Cannot find server '%s' ('%s').", server.Name, server.ID)
+	}
+
+	return updatedServer, nil
+}
@@ -0,0 +1,244 @@
+package steps
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"path"
+
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/artifacts"
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/helpers"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+)
+
+// DownloadOVFPackage is the step that downloads the files comprising an OVF package from CloudControl.
+//
+// If DeleteRemotePackage is true, the remote package files are deleted once they have been downloaded,
+// and also if the step sequence fails (so a failed download does not leave the exported package on the FTPS host).
+//
+// Expects:
+//   - Remote OVF package artifact in state from ExportCustomerImage step.
+type DownloadOVFPackage struct {
+	// The local directory into which the OVF package files will be downloaded.
+	TargetDirectory string
+
+	// The path of a file containing (PEM-encoded) CA certificates used to verify the FTPS host's certificate.
+	//
+	// If not specified, the system CA certificates are used.
+	FTPSCACertFile string
+
+	// Skip verification of the FTPS host's certificate?
+	FTPSSkipVerify bool
+
+	// Delete the OVF package files from the FTPS host once they have been downloaded and verified (or if the step sequence fails)?
+	DeleteRemotePackage bool
+
+	tlsConfig          *tls.Config
+	remotePackageFiles []string
+}
+
+// Run is called to perform the step's action.
+//
+// The return value determines whether multi-step sequences should continue or halt.
+func (step *DownloadOVFPackage) Run(stateBag multistep.StateBag) multistep.StepAction {
+	state := helpers.ForStateBag(stateBag)
+	ui := state.GetUI()
+
+	packageArtifact := state.GetRemoteOVFPackageArtifact()
+	if packageArtifact == nil {
+		state.ShowErrorMessage("Cannot find remote OVF package artifact in state data.")
+
+		return multistep.ActionHalt
+	}
+
+	err := os.MkdirAll(step.TargetDirectory, 0700 /* u=rwx */)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+
+	ui.Message(fmt.Sprintf(
+		"Downloading OVF package '%s' from '%s' to '%s'...",
+		packageArtifact.PackagePrefix,
+		packageArtifact.FTPSHostName,
+		step.TargetDirectory,
+	))
+
+	settings := state.GetSettings()
+
+	tlsConfig, err := helpers.CreateFTPSTLSConfig(packageArtifact.FTPSHostName, step.FTPSCACertFile, step.FTPSSkipVerify)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+	step.tlsConfig = tlsConfig
+
+	// Until we have the manifest, the descriptor and manifest are the only package files we know about.
+	manifestFileName := packageArtifact.PackagePrefix + ".mf"
+	step.remotePackageFiles = []string{
+		manifestFileName,
+		packageArtifact.PackagePrefix + ".ovf",
+	}
+
+	ftpsClient, err := helpers.ConnectFTPS(packageArtifact.FTPSHostName, settings.GetMCPUser(), settings.GetMCPPassword(), tlsConfig)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+	defer ftpsClient.Close()
+
+	// The manifest tells us which other files make up the package.
+	err = step.downloadFile(ftpsClient, manifestFileName, ui)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+
+	manifest, err := helpers.ReadOVFManifest(
+		path.Join(step.TargetDirectory, manifestFileName),
+	)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+	step.remotePackageFiles = []string{manifestFileName}
+	for _, entry := range manifest.Entries {
+		step.remotePackageFiles = append(step.remotePackageFiles, entry.FileName)
+	}
+	if manifest.GetEntry(packageArtifact.PackagePrefix+".ovf") == nil {
+		state.ShowErrorMessage("OVF manifest '%s' does not include the package's .ovf file.",
+			manifestFileName,
+		)
+
+		return multistep.ActionHalt
+	}
+
+	for _, entry := range manifest.Entries {
+		err = step.downloadFile(ftpsClient, entry.FileName, ui)
+		if err != nil {
+			state.ShowError(err)
+
+			return multistep.ActionHalt
+		}
+
+		localFile := path.Join(step.TargetDirectory, entry.FileName)
+		err = manifest.Verify(localFile)
+		if err != nil {
+			state.ShowError(err)
+
+			return multistep.ActionHalt
+		}
+
+		log.Printf("DownloadOVFPackage: verified %s digest for '%s'.", entry.Algorithm, localFile)
+	}
+
+	if step.DeleteRemotePackage {
+		step.deleteRemotePackage(ftpsClient, ui)
+	}
+
+	localFilesArtifact, err := artifacts.NewFromFilesInLocalDirectory(step.TargetDirectory, "ddcloud.ovf")
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+	state.SetTargetArtifact(localFilesArtifact)
+
+	ui.Message(fmt.Sprintf(
+		"Downloaded OVF package '%s' to '%s'.",
+		packageArtifact.PackagePrefix,
+		step.TargetDirectory,
+	))
+
+	return multistep.ActionContinue
+}
+
+// Cleanup is called in reverse order of the steps that have run
+// and allow steps to clean up after themselves. Do not assume if this
+// ran that the entire multi-step sequence completed successfully. This
+// method can be ran in the face of errors and cancellations as well.
+//
+// The parameter is the same "state bag" as Run, and represents the
+// state at the latest possible time prior to calling Cleanup.
+func (step *DownloadOVFPackage) Cleanup(stateBag multistep.StateBag) {
+	if !step.DeleteRemotePackage || len(step.remotePackageFiles) == 0 {
+		return // Nothing to do.
+	}
+
+	state := helpers.ForStateBag(stateBag)
+	ui := state.GetUI()
+
+	_, cancelled := state.GetOk(multistep.StateCancelled)
+	_, halted := state.GetOk(multistep.StateHalted)
+	if !(cancelled || halted) {
+		return // Package files were already deleted by Run.
+	}
+
+	packageArtifact := state.GetRemoteOVFPackageArtifact()
+	if packageArtifact == nil {
+		return
+	}
+
+	settings := state.GetSettings()
+	ftpsClient, err := helpers.ConnectFTPS(packageArtifact.FTPSHostName, settings.GetMCPUser(), settings.GetMCPPassword(), step.tlsConfig)
+	if err != nil {
+		ui.Error(err.Error())
+
+		return
+	}
+	defer ftpsClient.Close()
+
+	step.deleteRemotePackage(ftpsClient, ui)
+}
+
+var _ multistep.Step = &DownloadOVFPackage{}
+
+// Download a single file from the FTPS host into the target directory.
+func (step *DownloadOVFPackage) downloadFile(ftpsClient *helpers.FTPSClient, fileName string, ui packer.Ui) error {
+	ui.Message(fmt.Sprintf(
+		"Downloading '%s'...", fileName,
+	))
+
+	err := ftpsClient.Download(fileName, path.Join(step.TargetDirectory, fileName),
+		newTransferProgressReporter(ui, "Downloading", fileName),
+	)
+	if err != nil {
+		return err
+	}
+
+	ui.Message(fmt.Sprintf(
+		"Downloaded '%s'.", fileName,
+	))
+
+	return nil
+}
+
+// Delete the OVF package files from the FTPS host.
+//
+// Failure to delete the package files is reported, but does not cause the step to fail.
+func (step *DownloadOVFPackage) deleteRemotePackage(ftpsClient *helpers.FTPSClient, ui packer.Ui) {
+	ui.Message(fmt.Sprintf(
+		"Deleting OVF package files from '%s'...", ftpsClient.HostName,
+	))
+
+	var remainingFiles []string
+	for _, packageFileName := range step.remotePackageFiles {
+		err := ftpsClient.Delete(packageFileName)
+		if err != nil {
+			ui.Error(err.Error())
+			remainingFiles = append(remainingFiles, packageFileName)
+
+			continue
+		}
+
+		log.Printf("DownloadOVFPackage: deleted '%s' from '%s'.", packageFileName, ftpsClient.HostName)
+	}
+	step.remotePackageFiles = remainingFiles
+}
@@ -8,12 +8,14 @@ import (
 	"github.com/DimensionDataResearch/go-dd-cloud-compute/compute"
 	"github.com/DimensionDataResearch/packer-plugins-ddcloud/artifacts"
 	"github.com/DimensionDataResearch/packer-plugins-ddcloud/helpers"
-	"github.com/DimensionDataResearch/packer-plugins-ddcloud/postprocessors/customerimage-export/config"
 	"github.com/mitchellh/multistep"
 )
 
 // ExportCustomerImage is the step that exports a customer image to an OVF package.
-type ExportCustomerImage struct{}
+type ExportCustomerImage struct {
+	// The prefix for the OVF package files.
+	OVFPackagePrefix string
+}
 
 // Run is called to perform the step's action.
 //
@@ -22,7 +24,6 @@ func (step *ExportCustomerImage) Run(stateBag multistep.StateBag) multistep.Step
 	state := helpers.ForStateBag(stateBag)
 	ui := state.GetUI()
 
-	settings := state.GetSettings().(*config.Settings)
 	client := state.GetClient()
 
 	targetImage := state.GetTargetImage()
@@ -40,10 +41,10 @@ func (step *ExportCustomerImage) Run(stateBag multistep.StateBag) multistep.Step
 		"Export customer image '%s' ('%s') to OVF package '%s'.",
 		targetImageName,
 		targetImageID,
-		settings.OVFPackagePrefix,
+		step.OVFPackagePrefix,
 	))
 
-	exportID, err := client.ExportCustomerImage(targetImageID, settings.OVFPackagePrefix)
+	exportID, err := client.ExportCustomerImage(targetImageID, step.OVFPackagePrefix)
 	if err != nil {
 		ui.Error(err.Error())
 
@@ -80,7 +81,7 @@ func (step *ExportCustomerImage) Run(stateBag multistep.StateBag) multistep.Step
 
 	state.SetRemoteOVFPackageArtifact(&artifacts.RemoteOVFPackage{
 		FTPSHostName:  datacenterMetadata.FTPSHost,
-		PackagePrefix: settings.OVFPackagePrefix,
+		PackagePrefix: step.OVFPackagePrefix,
 		BuilderID:     state.GetBuilderID(),
 	})
 
@@ -0,0 +1,153 @@
+package steps
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/artifacts"
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/helpers"
+	"github.com/mitchellh/multistep"
+)
+
+// ExtractOVA is the step that extracts the OVF package files from a .ova archive in the source artifact (if any).
+//
+// If the source artifact contains a .ova file, it is replaced (in state data) by an artifact representing the extracted files.
+type ExtractOVA struct {
+	// The directory into which the .ova archive was extracted.
+	outputDir string
+}
+
+// Run is called to perform the step's action.
+//
+// The return value determines whether multi-step sequences should continue or halt.
+func (step *ExtractOVA) Run(stateBag multistep.StateBag) multistep.StepAction {
+	state := helpers.ForStateBag(stateBag)
+	ui := state.GetUI()
+
+	sourceArtifact := state.GetSourceArtifact()
+	if sourceArtifact == nil {
+		state.ShowErrorMessage("Cannot find source artifact in state data.")
+
+		return multistep.ActionHalt
+	}
+
+	ovaFile := artifacts.GetFirstFileWithExtension(".ova", sourceArtifact)
+	if ovaFile == "" {
+		return multistep.ActionContinue // Nothing to do.
+	}
+
+	var err error
+	step.outputDir, err = ioutil.TempDir(
+		"",                // Use default temp directory
+		"packer_ova_ovf_", // Directory prefix
+	)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+
+	ui.Message(fmt.Sprintf(
+		"Extracting OVA archive '%s'...",
+		ovaFile,
+	))
+
+	err = step.extractOVA(ovaFile)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+
+	ovfArtifact, err := artifacts.NewFromFilesInLocalDirectory(step.outputDir, "ddcloud.ova")
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+	state.SetSourceArtifact(ovfArtifact)
+
+	ui.Message(fmt.Sprintf(
+		"Extracted OVA archive '%s'.",
+		ovaFile,
+	))
+
+	return multistep.ActionContinue
+}
+
+// Cleanup is called in reverse order of the steps that have run
+// and allow steps to clean up after themselves. Do not assume if this
+// ran that the entire multi-step sequence completed successfully. This
+// method can be ran in the face of errors and cancellations as well.
+//
+// The parameter is the same "state bag" as Run, and represents the
+// state at the latest possible time prior to calling Cleanup.
+func (step *ExtractOVA) Cleanup(stateBag multistep.StateBag) {
+	if step.outputDir == "" {
+		return // Nothing to do.
+	}
+
+	state := helpers.ForStateBag(stateBag)
+
+	err := os.RemoveAll(step.outputDir)
+	if err != nil && !os.IsNotExist(err) {
+		state.SetLastError(err)
+		state.GetUI().Error(
+			err.Error(),
+		)
+	}
+
+	step.outputDir = ""
+}
+
+var _ multistep.Step = &ExtractOVA{}
+
+// Extract the files from an OVA (tar) archive into the output directory.
+func (step *ExtractOVA) extractOVA(ovaFile string) error {
+	archiveFile, err := os.Open(ovaFile)
+	if err != nil {
+		return err
+	}
+	defer archiveFile.Close()
+
+	archiveReader := tar.NewReader(archiveFile)
+	for {
+		header, err := archiveReader.Next()
+		if err == io.EOF {
+			break // We're done
+		}
+		if err != nil {
+			return fmt.Errorf("Unable to read OVA archive '%s': %s", ovaFile, err.Error())
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		// OVA archives are flat; ignore any directory components (this also prevents files being written outside the output directory).
+		targetFile := filepath.Join(step.outputDir, path.Base(header.Name))
+		err = extractFile(archiveReader, targetFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Write the current entry from an archive to a local file.
+func extractFile(archiveReader io.Reader, targetFile string) error {
+	file, err := os.Create(targetFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, archiveReader)
+
+	return err
+}
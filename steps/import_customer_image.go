@@ -11,6 +11,8 @@ import (
 )
 
 // ImportCustomerImage is the step that imports a customer image from an OVF package.
+//
+// If the CheckTargetImage step found an existing image to replace, it is replaced (see createOrReplaceCustomerImage).
 type ImportCustomerImage struct {
 	// The name of the target image to create.
 	TargetImageName string
@@ -34,41 +36,44 @@ func (step *ImportCustomerImage) Run(stateBag multistep.StateBag) multistep.Step
 
 	client := state.GetClient()
 
-	ui.Message(fmt.Sprintf(
-		"Create customer image '%s' in datacenter '%s' from OVF package '%s'.",
-		step.TargetImageName,
-		step.DatacenterID,
-		step.OVFPackagePrefix,
-	))
-
-	imageID, err := client.ImportCustomerImage(
-		step.TargetImageName,
-		step.TargetImageName+" (created by Packer).",
-		step.PreventGuestOSCustomization,
-		step.OVFPackagePrefix,
-		step.DatacenterID,
-	)
-	if err != nil {
-		ui.Error(err.Error())
-
-		return multistep.ActionHalt
-	}
-
-	ui.Message(fmt.Sprintf(
-		"Import of customer image '%s' ('%s') in progress...",
-		step.TargetImageName,
-		imageID,
-	))
-
-	resource, err := client.WaitForDeploy(compute.ResourceTypeCustomerImage, imageID, 30*time.Minute)
+	image, err := createOrReplaceCustomerImage(state, step.TargetImageName, func(imageName string) (*compute.CustomerImage, error) {
+		ui.Message(fmt.Sprintf(
+			"Create customer image '%s' in datacenter '%s' from OVF package '%s'.",
+			imageName,
+			step.DatacenterID,
+			step.OVFPackagePrefix,
+		))
+
+		imageID, importError := client.ImportCustomerImage(
+			imageName,
+			imageName+" (created by Packer).",
+			step.PreventGuestOSCustomization,
+			step.OVFPackagePrefix,
+			step.DatacenterID,
+		)
+		if importError != nil {
+			return nil, importError
+		}
+
+		ui.Message(fmt.Sprintf(
+			"Import of customer image '%s' ('%s') in progress...",
+			imageName,
+			imageID,
+		))
+
+		resource, importError := client.WaitForDeploy(compute.ResourceTypeCustomerImage, imageID, 30*time.Minute)
+		if importError != nil {
+			return nil, importError
+		}
+
+		return resource.(*compute.CustomerImage), nil
+	})
 	if err != nil {
 		ui.Error(err.Error())
 
 		return multistep.ActionHalt
 	}
 
-	image := resource.(*compute.CustomerImage)
-
 	ui.Message(fmt.Sprintf(
 		"Import of customer image '%s' ('%s) complete.",
 		image.Name,
@@ -76,10 +81,9 @@ func (step *ImportCustomerImage) Run(stateBag multistep.StateBag) multistep.Step
 	))
 
 	state.SetTargetImage(image)
-	state.SetTargetImageArtifact(&artifacts.Image{
-		Image:     image,
-		BuilderID: state.GetBuilderID(),
-	})
+	state.SetTargetImageArtifact(artifacts.NewImage(image, state.GetBuilderID(),
+		newCustomerImageDeleter(client, image.ID),
+	))
 
 	return multistep.ActionContinue
 }
@@ -0,0 +1,191 @@
+package steps
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/builders/customerimage/config"
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/helpers"
+	"github.com/mitchellh/multistep"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// InstallTemporarySSHKey is the step that generates a temporary SSH key pair and installs its public key on the target server.
+//
+// The key is installed by connecting with the initial password, so that subsequent connections (e.g. from provisioners) can use key-based authentication.
+// CloudControl cannot inject SSH keys when deploying a server, so the source image must permit password authentication via SSH (at least until the key has been installed).
+//
+// If build resources are retained (on_error = "abort"), the private key is written to a file in a new temporary directory
+// (see saveTemporarySSHPrivateKey) so that the server can still be reached.
+//
+// Expects:
+//   - Target server in state from DeployServer step.
+//   - Communicator host (if exposed via NAT) from CreateNATRule step.
+type InstallTemporarySSHKey struct{}
+
+// Run is called to perform the step's action.
+//
+// The return value determines whether multi-step sequences should continue or halt.
+func (step *InstallTemporarySSHKey) Run(stateBag multistep.StateBag) multistep.StepAction {
+	state := helpers.ForStateBag(stateBag)
+	ui := state.GetUI()
+
+	settings := state.GetSettings().(*config.Settings)
+	if !settings.SSHTemporaryKeyPair {
+		return multistep.ActionContinue
+	}
+
+	server := state.GetServer()
+	communicatorConfig := settings.CommunicatorConfig
+
+	ui.Message(fmt.Sprintf(
+		"Generating temporary SSH key pair for server '%s' ('%s')...",
+		server.Name,
+		server.ID,
+	))
+
+	privateKeyPEM, authorizedKey, err := helpers.GenerateSSHKeyPair(
+		temporarySSHKeyComment(settings),
+	)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+
+	hostKeyCallback, err := helpers.SSHHostKeyCallback(settings.SSHHostKeyFingerprint, settings.SSHKnownHostsFile)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+
+	clientConfig := &gossh.ClientConfig{
+		User: communicatorConfig.SSHUsername,
+		Auth: []gossh.AuthMethod{
+			gossh.Password(communicatorConfig.SSHPassword),
+		},
+		HostKeyCallback: hostKeyCallback,
+	}
+	address := net.JoinHostPort(communicatorConfig.SSHHost, strconv.Itoa(communicatorConfig.SSHPort))
+
+	ui.Message(fmt.Sprintf(
+		"Installing temporary SSH public key for user '%s' on server '%s' ('%s') via '%s'...",
+		communicatorConfig.SSHUsername,
+		server.Name,
+		server.ID,
+		address,
+	))
+
+	client, err := step.dialWithRetry(address, clientConfig, communicatorConfig.SSHTimeout)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+	defer session.Close()
+
+	installCommand := fmt.Sprintf(
+		"umask 077 && mkdir -p ~/.ssh && echo '%s' >> ~/.ssh/authorized_keys",
+		authorizedKey,
+	)
+	output, err := session.CombinedOutput(installCommand)
+	if err != nil {
+		state.ShowErrorMessage("Failed to install temporary SSH public key on server '%s' ('%s'): %s\n%s",
+			server.Name,
+			server.ID,
+			err.Error(),
+			string(output),
+		)
+
+		return multistep.ActionHalt
+	}
+
+	state.SetTemporarySSHPrivateKey(privateKeyPEM)
+
+	ui.Message(fmt.Sprintf(
+		"Installed temporary SSH public key on server '%s' ('%s').",
+		server.Name,
+		server.ID,
+	))
+
+	return multistep.ActionContinue
+}
+
+// Cleanup is called in reverse order of the steps that have run
+// and allow steps to clean up after themselves. Do not assume if this
+// ran that the entire multi-step sequence completed successfully. This
+// method can be ran in the face of errors and cancellations as well.
+//
+// The parameter is the same "state bag" as Run, and represents the
+// state at the latest possible time prior to calling Cleanup.
+func (step *InstallTemporarySSHKey) Cleanup(stateBag multistep.StateBag) {
+	// Nothing to do; if build resources are retained, the key is saved by showRetainedBuildResources.
+}
+
+var _ multistep.Step = &InstallTemporarySSHKey{}
+
+// Connect to the server via SSH, retrying until the connection succeeds or the timeout is reached.
+func (step *InstallTemporarySSHKey) dialWithRetry(address string, clientConfig *gossh.ClientConfig, timeout time.Duration) (client *gossh.Client, err error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		client, err = gossh.Dial("tcp", address, clientConfig)
+		if err == nil {
+			return
+		}
+
+		// The server is up, but won't accept the password; retrying won't help.
+		if strings.Contains(err.Error(), "unable to authenticate") {
+			err = fmt.Errorf("The server at '%s' rejected password authentication via SSH (%s); 'ssh_temporary_key_pair' requires the source image to permit SSH password authentication so that the temporary key can be installed. If the source image only permits key-based authentication, use 'ssh_private_key_file' or 'ssh_agent_auth' with a key that is already authorised on the source image", address, err.Error())
+
+			return
+		}
+
+		if time.Now().After(deadline) {
+			err = fmt.Errorf("Timed out connecting to '%s' via SSH: %s", address, err.Error())
+
+			return
+		}
+
+		log.Printf("InstallTemporarySSHKey: unable to connect to '%s' (%s); will retry...", address, err.Error())
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// Save the temporary SSH private key to a file (readable only by the current user) in a new temporary directory.
+func saveTemporarySSHPrivateKey(settings *config.Settings, privateKeyPEM []byte) (privateKeyFile string, err error) {
+	privateKeyDirectory, err := ioutil.TempDir(
+		"",                    // Use default temp directory
+		"packer_ddcloud_ssh_", // Directory prefix
+	)
+	if err != nil {
+		return
+	}
+
+	privateKeyFile = filepath.Join(privateKeyDirectory,
+		fmt.Sprintf("%s.pem", temporarySSHKeyComment(settings)),
+	)
+	err = ioutil.WriteFile(privateKeyFile, privateKeyPEM, 0600)
+
+	return
+}
+
+// The comment used to identify the temporary SSH key in authorized_keys.
+func temporarySSHKeyComment(settings *config.Settings) string {
+	return fmt.Sprintf("packer-%s", settings.UniquenessKey)
+}
@@ -0,0 +1,143 @@
+package steps
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/builders/customerimage/config"
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/helpers"
+	"github.com/mitchellh/multistep"
+)
+
+// Determine whether build resources (server, NAT rule, firewall rules) should be retained during cleanup, rather than being destroyed.
+//
+// Resources are only ever retained if the build failed, and the configured 'on_error' mode is "abort" (or is "ask", and the user chose to abort).
+// The decision is made once, and then remembered for the remaining steps.
+func shouldRetainBuildResources(state helpers.State) bool {
+	retain, decided := state.GetRetainBuildResources()
+	if decided {
+		return retain
+	}
+
+	_, cancelled := state.GetOk(multistep.StateCancelled)
+	_, halted := state.GetOk(multistep.StateHalted)
+	if cancelled || halted {
+		settings := state.GetSettings().(*config.Settings)
+		switch settings.OnError {
+		case "abort":
+			retain = true
+		case "ask":
+			retain = askToRetainBuildResources(state)
+		}
+	}
+	state.SetRetainBuildResources(retain)
+
+	if retain {
+		showRetainedBuildResources(state)
+	}
+
+	return retain
+}
+
+// Ask the user whether to clean up build resources or retain them (abort).
+func askToRetainBuildResources(state helpers.State) bool {
+	ui := state.GetUI()
+
+	for {
+		answer, err := ui.Ask("The build failed. [c] Clean up build resources, [a] abort (retain build resources for debugging):")
+		if err != nil {
+			log.Printf("Unable to prompt for 'on_error' action (%s); build resources will be cleaned up.", err.Error())
+
+			return false
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "c":
+			return false
+		case "a":
+			return true
+		}
+	}
+}
+
+// Display details of the retained build resources, including how to reach them and how to clean them up later.
+func showRetainedBuildResources(state helpers.State) {
+	ui := state.GetUI()
+
+	settings := state.GetSettings().(*config.Settings)
+	networkDomain := state.GetNetworkDomain()
+	server := state.GetServer()
+	if server == nil {
+		return // Nothing to show.
+	}
+
+	message := fmt.Sprintf("Build failed; retaining build resources in network domain '%s' ('%s') for debugging (on_error = '%s'):\n",
+		networkDomain.Name,
+		networkDomain.ID,
+		settings.OnError,
+	)
+	message += fmt.Sprintf("- Server '%s' ('%s') with private IPv4 address '%s'\n",
+		server.Name,
+		server.ID,
+		*server.Network.PrimaryAdapter.PrivateIPv4Address,
+	)
+
+	natRule := state.GetNATRule()
+	if natRule != nil {
+		message += fmt.Sprintf("- NAT rule '%s' ('%s' -> '%s')\n",
+			natRule.ID,
+			natRule.ExternalIPAddress,
+			natRule.InternalIPAddress,
+		)
+	}
+	for _, firewallRule := range state.GetFirewallRules() {
+		message += fmt.Sprintf("- Firewall rule '%s' ('%s')\n",
+			firewallRule.Name,
+			firewallRule.ID,
+		)
+	}
+	publicIPBlockID := state.GetAllocatedPublicIPBlockID()
+	if publicIPBlockID != "" {
+		message += fmt.Sprintf("- Public IP block '%s'\n",
+			publicIPBlockID,
+		)
+	}
+
+	communicatorConfig := settings.CommunicatorConfig
+	switch communicatorConfig.Type {
+	case "ssh":
+		message += fmt.Sprintf("The server can be reached via SSH at '%s@%s' (port %d).\n",
+			communicatorConfig.SSHUsername,
+			communicatorConfig.SSHHost,
+			communicatorConfig.SSHPort,
+		)
+
+		privateKeyPEM := state.GetTemporarySSHPrivateKey()
+		if privateKeyPEM != nil {
+			privateKeyFile, err := saveTemporarySSHPrivateKey(settings, privateKeyPEM)
+			if err != nil {
+				message += fmt.Sprintf("Failed to save the temporary SSH private key: %s\n", err.Error())
+			} else {
+				message += fmt.Sprintf("The temporary SSH private key has been saved to '%s' (delete it when you are done); use 'ssh -i %s -p %d %s@%s'.\n",
+					privateKeyFile,
+					privateKeyFile,
+					communicatorConfig.SSHPort,
+					communicatorConfig.SSHUsername,
+					communicatorConfig.SSHHost,
+				)
+			}
+		}
+	case "winrm":
+		message += fmt.Sprintf("The server can be reached via WinRM at '%s' (port %d) as '%s'.\n",
+			communicatorConfig.WinRMHost,
+			communicatorConfig.WinRMPort,
+			communicatorConfig.WinRMUser,
+		)
+	}
+
+	message += "When you are done, delete these resources (in the following order): firewall rules, NAT rule, server (shut it down first), public IP block.\n"
+	message += "Alternatively, run this plugin's executable with the 'sweep' argument to find and destroy orphaned build resources."
+
+	ui.Message(message)
+}
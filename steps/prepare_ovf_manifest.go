@@ -0,0 +1,312 @@
+package steps
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/artifacts"
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/helpers"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+)
+
+// PrepareOVFManifest is the step that ensures a local OVF package has a valid manifest (.mf) file.
+//
+// If the package has no manifest, one is generated (using SHA1 digests, as required by CloudControl).
+// The package files are staged (together with the new manifest) in a working directory, so the source artifact's own files are never modified.
+// If the package already has a manifest, the digest of each package file is verified against it.
+//
+// Expects:
+//   - OVF package files from source artifact in state from ConvertVMXToOVF step.
+type PrepareOVFManifest struct {
+	// The working directory in which the package (with its generated manifest) was staged.
+	workingDir string
+}
+
+// Run is called to perform the step's action.
+//
+// The return value determines whether multi-step sequences should continue or halt.
+func (step *PrepareOVFManifest) Run(stateBag multistep.StateBag) multistep.StepAction {
+	state := helpers.ForStateBag(stateBag)
+	ui := state.GetUI()
+
+	sourceArtifact := state.GetSourceArtifact()
+	if sourceArtifact == nil {
+		state.ShowErrorMessage("Cannot find source artifact in state data.")
+
+		return multistep.ActionHalt
+	}
+
+	ovfFile := artifacts.GetFirstFileWithExtension(".ovf", sourceArtifact)
+	if ovfFile == "" {
+		state.ShowErrorMessage("Cannot find .ovf file in source artifact '%s'.",
+			sourceArtifact.Id(),
+		)
+
+		return multistep.ActionHalt
+	}
+
+	// The package consists of the descriptor, and the files it references.
+	referencedFileNames, err := readOVFFileReferences(ovfFile)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+	packageFiles, err := getOVFPackageFiles(ovfFile, referencedFileNames, sourceArtifact)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+
+	manifestFile := artifacts.GetFirstFileWithExtension(".mf", sourceArtifact)
+	if manifestFile != "" {
+		ui.Message(fmt.Sprintf(
+			"Verifying OVF package files against manifest '%s'...",
+			manifestFile,
+		))
+
+		err = step.verifyManifest(manifestFile, packageFiles, sourceArtifact.Files())
+		if err != nil {
+			state.ShowError(err)
+
+			return multistep.ActionHalt
+		}
+
+		ui.Message(fmt.Sprintf(
+			"Verified OVF package files against manifest '%s'.",
+			manifestFile,
+		))
+
+		return multistep.ActionContinue
+	}
+
+	step.workingDir, err = ioutil.TempDir(
+		"",                     // Use default temp directory
+		"packer_ovf_manifest_", // Directory prefix
+	)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+
+	manifestFile = path.Join(step.workingDir,
+		strings.TrimSuffix(path.Base(ovfFile), ".ovf")+".mf",
+	)
+
+	ui.Message(fmt.Sprintf(
+		"OVF package has no manifest; generating '%s'...",
+		path.Base(manifestFile),
+	))
+
+	err = step.generateManifest(manifestFile, packageFiles)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+
+	// Stage the package files alongside the new manifest.
+	for _, packageFile := range packageFiles {
+		err = linkOrCopyFile(packageFile,
+			path.Join(step.workingDir, path.Base(packageFile)),
+		)
+		if err != nil {
+			state.ShowError(err)
+
+			return multistep.ActionHalt
+		}
+	}
+
+	ovfArtifact, err := artifacts.NewFromFilesInLocalDirectory(
+		step.workingDir,
+		sourceArtifact.BuilderId(),
+	)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+	state.SetSourceArtifact(ovfArtifact)
+
+	ui.Message(fmt.Sprintf(
+		"Generated OVF manifest '%s'.",
+		path.Base(manifestFile),
+	))
+
+	return multistep.ActionContinue
+}
+
+// Cleanup is called in reverse order of the steps that have run
+// and allow steps to clean up after themselves. Do not assume if this
+// ran that the entire multi-step sequence completed successfully. This
+// method can be ran in the face of errors and cancellations as well.
+//
+// The parameter is the same "state bag" as Run, and represents the
+// state at the latest possible time prior to calling Cleanup.
+func (step *PrepareOVFManifest) Cleanup(stateBag multistep.StateBag) {
+	if step.workingDir == "" {
+		return // Nothing to do.
+	}
+
+	state := helpers.ForStateBag(stateBag)
+
+	err := os.RemoveAll(step.workingDir)
+	if err != nil && !os.IsNotExist(err) {
+		state.SetLastError(err)
+		state.GetUI().Error(
+			err.Error(),
+		)
+	}
+
+	step.workingDir = ""
+}
+
+var _ multistep.Step = &PrepareOVFManifest{}
+
+// Verify that every package file has a manifest entry, and that its digest matches that entry.
+//
+// Manifest entries for other files (e.g. NVRAM or certificate files) are verified if those files are present in the source artifact, and otherwise ignored.
+func (step *PrepareOVFManifest) verifyManifest(manifestFile string, packageFiles []string, sourceFiles []string) (err error) {
+	manifest, err := helpers.ReadOVFManifest(manifestFile)
+	if err != nil {
+		return
+	}
+
+	verifiedFileNames := make(map[string]bool)
+	for _, packageFile := range packageFiles {
+		verifiedFileNames[path.Base(packageFile)] = true
+
+		verifyError := manifest.Verify(packageFile)
+		if verifyError != nil {
+			err = packer.MultiErrorAppend(err, verifyError)
+
+			continue
+		}
+
+		log.Printf("PrepareOVFManifest: verified digest for '%s'.", packageFile)
+	}
+
+	sourceFilesByName := make(map[string]string)
+	for _, sourceFile := range sourceFiles {
+		sourceFilesByName[path.Base(sourceFile)] = sourceFile
+	}
+	for _, entry := range manifest.Entries {
+		if verifiedFileNames[entry.FileName] {
+			continue
+		}
+
+		sourceFile, ok := sourceFilesByName[entry.FileName]
+		if !ok {
+			log.Printf("PrepareOVFManifest: ignoring manifest entry for '%s' (file is not referenced by the OVF descriptor, and is not present).", entry.FileName)
+
+			continue
+		}
+
+		verifyError := manifest.Verify(sourceFile)
+		if verifyError != nil {
+			err = packer.MultiErrorAppend(err, verifyError)
+
+			continue
+		}
+
+		log.Printf("PrepareOVFManifest: verified digest for '%s'.", sourceFile)
+	}
+
+	return
+}
+
+// Generate a manifest containing SHA1 digests for the specified package files.
+func (step *PrepareOVFManifest) generateManifest(manifestFile string, packageFiles []string) error {
+	manifest := &helpers.OVFManifest{}
+	for _, packageFile := range packageFiles {
+		digest, err := helpers.ComputeFileDigest(packageFile, "SHA1")
+		if err != nil {
+			return err
+		}
+
+		manifest.Entries = append(manifest.Entries, helpers.OVFManifestEntry{
+			Algorithm: "SHA1",
+			FileName:  path.Base(packageFile),
+			Digest:    digest,
+		})
+
+		log.Printf("PrepareOVFManifest: computed digest for '%s'.", packageFile)
+	}
+
+	return manifest.Write(manifestFile)
+}
+
+// Get the local files that comprise an OVF package (the descriptor, and the files it references).
+//
+// Every referenced file must be present in the source artifact.
+func getOVFPackageFiles(ovfFile string, referencedFileNames []string, sourceArtifact packer.Artifact) (packageFiles []string, err error) {
+	sourceFilesByName := make(map[string]string)
+	for _, sourceFile := range sourceArtifact.Files() {
+		sourceFilesByName[path.Base(sourceFile)] = sourceFile
+	}
+
+	packageFiles = append(packageFiles, ovfFile)
+	for _, referencedFileName := range referencedFileNames {
+		sourceFile, ok := sourceFilesByName[referencedFileName]
+		if !ok {
+			err = packer.MultiErrorAppend(err, fmt.Errorf(
+				"OVF descriptor '%s' references file '%s', which is not part of the source artifact",
+				ovfFile,
+				referencedFileName,
+			))
+
+			continue
+		}
+
+		packageFiles = append(packageFiles, sourceFile)
+	}
+
+	return
+}
+
+// Read the names of the files referenced by an OVF descriptor (the "ovf:href" attributes of its References/File elements).
+func readOVFFileReferences(ovfFile string) (fileNames []string, err error) {
+	file, err := os.Open(ovfFile)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	decoder := xml.NewDecoder(file)
+	for {
+		var token xml.Token
+		token, err = decoder.Token()
+		if err == io.EOF {
+			err = nil
+
+			break // We're done
+		}
+		if err != nil {
+			err = fmt.Errorf("Unable to read OVF descriptor '%s': %s", ovfFile, err.Error())
+
+			return
+		}
+
+		element, ok := token.(xml.StartElement)
+		if !ok || element.Name.Local != "File" {
+			continue
+		}
+		for _, attribute := range element.Attr {
+			if attribute.Name.Local == "href" {
+				// References are relative to the descriptor (and CloudControl requires a flat package).
+				fileNames = append(fileNames, path.Base(attribute.Value))
+			}
+		}
+	}
+
+	return
+}
@@ -0,0 +1,206 @@
+package steps
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/DimensionDataResearch/go-dd-cloud-compute/compute"
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/artifacts"
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/helpers"
+	"github.com/mitchellh/multistep"
+)
+
+// PruneCustomerImages is the step that deletes older versions of a customer image.
+//
+// Customer images are considered to be versions of the target image if their names match NamePattern,
+// or consist of ImageFamily followed by a separator ("-", "_", or ".") and a version (which must start with a digit, optionally preceded by "v").
+// The newest Keep versions are retained, and the target image itself is never deleted.
+// The full list of images to be deleted is displayed before any of them are deleted.
+//
+// Expects:
+//   - Target image artifact in state.
+type PruneCustomerImages struct {
+	// The Id of the datacenter containing the images to prune.
+	//
+	// If not specified, the target image's datacenter is used.
+	DatacenterID string
+
+	// If specified, images whose names match this regular expression are considered versions of the target image.
+	NamePattern *regexp.Regexp
+
+	// If specified, images whose names consist of this prefix, a separator, and a version are considered versions of the target image.
+	//
+	// For example, if ImageFamily is "base" (or "base-"), then "base-1.2" and "base-20170301" match, but "base-web-1.2" and "baseline-1.2" do not.
+	ImageFamily string
+
+	// The number of versions (including the target image) to keep.
+	Keep int
+
+	// Only list the images that would be deleted (rather than actually deleting them)?
+	DryRun bool
+}
+
+// Run is called to perform the step's action.
+//
+// The return value determines whether multi-step sequences should continue or halt.
+func (step *PruneCustomerImages) Run(stateBag multistep.StateBag) multistep.StepAction {
+	state := helpers.ForStateBag(stateBag)
+	ui := state.GetUI()
+
+	client := state.GetClient()
+
+	targetImageArtifact := state.GetTargetImageArtifact()
+	if targetImageArtifact == nil {
+		state.ShowErrorMessage("Cannot find target image artifact in state data.")
+
+		return multistep.ActionHalt
+	}
+	targetImageID := targetImageArtifact.Image.GetID()
+
+	datacenterID := step.DatacenterID
+	if datacenterID == "" {
+		datacenterID = targetImageArtifact.Image.GetDatacenterID()
+	}
+
+	ui.Message(fmt.Sprintf(
+		"Finding older versions of image '%s' ('%s') in datacenter '%s'...",
+		targetImageArtifact.Image.GetName(),
+		targetImageID,
+		datacenterID,
+	))
+
+	versions, err := step.findImageVersions(client, datacenterID)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+
+	keepImages, pruneImages := selectImagesToPrune(versions, step.Keep, targetImageID)
+	for _, image := range keepImages {
+		ui.Message(fmt.Sprintf(
+			"Keeping image '%s' ('%s'), created %s.", image.GetName(), image.GetID(), artifacts.GetImageCreateTime(image),
+		))
+	}
+	if len(pruneImages) == 0 {
+		ui.Message("No images need to be pruned.")
+
+		return multistep.ActionContinue
+	}
+
+	pruneMessage := fmt.Sprintf("The following %d image(s) will be deleted:\n", len(pruneImages))
+	if step.DryRun {
+		pruneMessage = fmt.Sprintf("The following %d image(s) would be deleted (dry run):\n", len(pruneImages))
+	}
+	for _, image := range pruneImages {
+		pruneMessage += fmt.Sprintf("- '%s' ('%s'), created %s\n", image.GetName(), image.GetID(), artifacts.GetImageCreateTime(image))
+	}
+	ui.Message(pruneMessage)
+
+	if step.DryRun {
+		return multistep.ActionContinue
+	}
+
+	for _, image := range pruneImages {
+		ui.Message(fmt.Sprintf(
+			"Deleting image '%s' ('%s'), created %s...", image.GetName(), image.GetID(), artifacts.GetImageCreateTime(image),
+		))
+
+		deleteImage := newCustomerImageDeleter(client, image.GetID())
+		err = deleteImage()
+		if err != nil {
+			state.ShowError(err)
+
+			return multistep.ActionHalt
+		}
+
+		ui.Message(fmt.Sprintf(
+			"Deleted image '%s' ('%s').", image.GetName(), image.GetID(),
+		))
+	}
+
+	return multistep.ActionContinue
+}
+
+// Cleanup is called in reverse order of the steps that have run
+// and allow steps to clean up after themselves. Do not assume if this
+// ran that the entire multi-step sequence completed successfully. This
+// method can be ran in the face of errors and cancellations as well.
+//
+// The parameter is the same "state bag" as Run, and represents the
+// state at the latest possible time prior to calling Cleanup.
+func (step *PruneCustomerImages) Cleanup(state multistep.StateBag) {
+}
+
+var _ multistep.Step = &PruneCustomerImages{}
+
+// Find all (usable) versions of the target image in the specified datacenter.
+func (step *PruneCustomerImages) findImageVersions(client *compute.Client, datacenterID string) (versions []compute.Image, err error) {
+	versionPattern := step.getVersionPattern()
+
+	page := compute.DefaultPaging()
+	for {
+		var images *compute.CustomerImages
+		images, err = client.ListCustomerImagesInDatacenter(datacenterID, page)
+		if err != nil {
+			return
+		}
+		if images.IsEmpty() {
+			break // We're done
+		}
+
+		for index := range images.Images {
+			image := &images.Images[index]
+			if image.State != "NORMAL" {
+				continue // Image is being created, deleted, etc.
+			}
+
+			if versionPattern.MatchString(image.Name) {
+				versions = append(versions, image)
+			}
+		}
+
+		page.Next()
+	}
+
+	return
+}
+
+// Get the regular expression that matches the names of versions of the target image.
+func (step *PruneCustomerImages) getVersionPattern() *regexp.Regexp {
+	if step.NamePattern != nil {
+		return step.NamePattern
+	}
+
+	return newImageFamilyPattern(step.ImageFamily)
+}
+
+// Determine which versions of an image to keep (the newest keep versions, plus the target image) and which to prune.
+//
+// Both lists are ordered newest first.
+func selectImagesToPrune(versions []compute.Image, keep int, targetImageID string) (keepImages []compute.Image, pruneImages []compute.Image) {
+	sortedVersions := make([]compute.Image, len(versions))
+	copy(sortedVersions, versions)
+	sort.Stable(sort.Reverse(imagesByCreateTime(sortedVersions)))
+
+	for index, image := range sortedVersions {
+		if index < keep || image.GetID() == targetImageID {
+			keepImages = append(keepImages, image)
+		} else {
+			pruneImages = append(pruneImages, image)
+		}
+	}
+
+	return
+}
+
+// Create a regular expression that matches versions of the specified image family (the family name, a separator, and a version).
+func newImageFamilyPattern(imageFamily string) *regexp.Regexp {
+	familyName := strings.TrimRight(imageFamily, "-_.")
+
+	return regexp.MustCompile(
+		"^" + regexp.QuoteMeta(familyName) + `[-_.]v?[0-9][A-Za-z0-9._-]*$`,
+	)
+}
@@ -0,0 +1,94 @@
+package steps
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DimensionDataResearch/go-dd-cloud-compute/compute"
+)
+
+func TestNewImageFamilyPattern(test *testing.T) {
+	testCases := []struct {
+		imageFamily string
+		imageName   string
+		matches     bool
+	}{
+		{"base", "base-1.2", true},
+		{"base", "base_1.2", true},
+		{"base", "base.1.2", true},
+		{"base", "base-v1.2", true},
+		{"base", "base-20170301", true},
+		{"base", "base-1.2-rc1", true},
+		{"base-", "base-1.2", true},
+		{"base.", "base.1.2", true},
+		{"base", "base", false},
+		{"base", "base-", false},
+		{"base", "base-latest", false},
+		{"base", "base-web-1.2", false},
+		{"base", "baseline-1.2", false},
+		{"base", "my-base-1.2", false},
+		{"base", "base-1.2 (copy)", false},
+		{"base.image", "base.image-1", true},
+		{"base.image", "baseximage-1", false},
+		{"base+", "base+-1", true},
+	}
+
+	for _, testCase := range testCases {
+		pattern := newImageFamilyPattern(testCase.imageFamily)
+		if pattern.MatchString(testCase.imageName) != testCase.matches {
+			test.Errorf("image family '%s', image '%s': matches is %t (expected %t)",
+				testCase.imageFamily, testCase.imageName, !testCase.matches, testCase.matches,
+			)
+		}
+	}
+}
+
+func TestSelectImagesToPrune(test *testing.T) {
+	images := []compute.Image{
+		&compute.CustomerImage{ID: "image-2", Name: "base-2", CreateTime: "2017-01-02T00:00:00.000Z"},
+		&compute.CustomerImage{ID: "image-4", Name: "base-4", CreateTime: "2017-01-04T00:00:00.000Z"},
+		&compute.CustomerImage{ID: "image-1", Name: "base-1", CreateTime: "2017-01-01T00:00:00.000Z"},
+		&compute.CustomerImage{ID: "image-3", Name: "base-3", CreateTime: "2017-01-03T00:00:00.000Z"},
+	}
+
+	testCases := []struct {
+		name          string
+		keep          int
+		targetImageID string
+		expectedKeep  []string
+		expectedPrune []string
+	}{
+		{"keep newest", 2, "image-4", []string{"image-4", "image-3"}, []string{"image-2", "image-1"}},
+		{"keep one", 1, "image-4", []string{"image-4"}, []string{"image-3", "image-2", "image-1"}},
+		{"older target image is kept", 1, "image-2", []string{"image-4", "image-2"}, []string{"image-3", "image-1"}},
+		{"target image not found", 2, "image-5", []string{"image-4", "image-3"}, []string{"image-2", "image-1"}},
+		{"keep all", 4, "image-4", []string{"image-4", "image-3", "image-2", "image-1"}, nil},
+		{"keep more than all", 10, "image-4", []string{"image-4", "image-3", "image-2", "image-1"}, nil},
+	}
+
+	for _, testCase := range testCases {
+		keepImages, pruneImages := selectImagesToPrune(images, testCase.keep, testCase.targetImageID)
+
+		actualKeep := getTestImageIDs(keepImages)
+		if !reflect.DeepEqual(actualKeep, testCase.expectedKeep) {
+			test.Errorf("%s: kept %v (expected %v)", testCase.name, actualKeep, testCase.expectedKeep)
+		}
+		actualPrune := getTestImageIDs(pruneImages)
+		if !reflect.DeepEqual(actualPrune, testCase.expectedPrune) {
+			test.Errorf("%s: pruned %v (expected %v)", testCase.name, actualPrune, testCase.expectedPrune)
+		}
+	}
+
+	// The caller's list must not be reordered.
+	if actualImages := getTestImageIDs(images); !reflect.DeepEqual(actualImages, []string{"image-2", "image-4", "image-1", "image-3"}) {
+		test.Errorf("input images were reordered: %v", actualImages)
+	}
+}
+
+func getTestImageIDs(images []compute.Image) (imageIDs []string) {
+	for _, image := range images {
+		imageIDs = append(imageIDs, image.GetID())
+	}
+
+	return
+}
@@ -0,0 +1,88 @@
+package steps
+
+import (
+	"fmt"
+
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/builders/customerimage/config"
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/helpers"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+)
+
+// RemoveTemporarySSHKey is the step that removes the temporary SSH public key from the target server (so it is not captured in the image).
+//
+// Expects:
+//   - Communicator in state from StepConnect.
+//   - Temporary SSH key installed by InstallTemporarySSHKey step.
+type RemoveTemporarySSHKey struct{}
+
+// Run is called to perform the step's action.
+//
+// The return value determines whether multi-step sequences should continue or halt.
+func (step *RemoveTemporarySSHKey) Run(stateBag multistep.StateBag) multistep.StepAction {
+	state := helpers.ForStateBag(stateBag)
+	ui := state.GetUI()
+
+	settings := state.GetSettings().(*config.Settings)
+	if !settings.SSHTemporaryKeyPair || state.GetTemporarySSHPrivateKey() == nil {
+		return multistep.ActionContinue
+	}
+
+	server := state.GetServer()
+
+	value, ok := state.GetOk("communicator")
+	if !ok || value == nil {
+		state.ShowErrorMessage("Cannot find communicator in state data.")
+
+		return multistep.ActionHalt
+	}
+	comm := value.(packer.Communicator)
+
+	ui.Message(fmt.Sprintf(
+		"Removing temporary SSH public key from server '%s' ('%s')...",
+		server.Name,
+		server.ID,
+	))
+
+	removeCommand := &packer.RemoteCmd{
+		Command: fmt.Sprintf(
+			"sed -i '/ %s$/d' ~/.ssh/authorized_keys",
+			temporarySSHKeyComment(settings),
+		),
+	}
+	err := removeCommand.StartWithUi(comm, ui)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+	if removeCommand.ExitStatus != 0 {
+		state.ShowErrorMessage("Failed to remove temporary SSH public key from server '%s' ('%s') (exit status %d).",
+			server.Name,
+			server.ID,
+			removeCommand.ExitStatus,
+		)
+
+		return multistep.ActionHalt
+	}
+
+	ui.Message(fmt.Sprintf(
+		"Removed temporary SSH public key from server '%s' ('%s').",
+		server.Name,
+		server.ID,
+	))
+
+	return multistep.ActionContinue
+}
+
+// Cleanup is called in reverse order of the steps that have run
+// and allow steps to clean up after themselves. Do not assume if this
+// ran that the entire multi-step sequence completed successfully. This
+// method can be ran in the face of errors and cancellations as well.
+//
+// The parameter is the same "state bag" as Run, and represents the
+// state at the latest possible time prior to calling Cleanup.
+func (step *RemoveTemporarySSHKey) Cleanup(state multistep.StateBag) {
+}
+
+var _ multistep.Step = &RemoveTemporarySSHKey{}
@@ -0,0 +1,67 @@
+package steps
+
+import (
+	"fmt"
+
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/builders/customerimage/config"
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/helpers"
+	"github.com/mitchellh/multistep"
+)
+
+// ResolveClientIP is the step that discovers the client's public IPv4 address (if `client_ip` is "auto").
+type ResolveClientIP struct{}
+
+// Run is called to perform the step's action.
+//
+// The return value determines whether multi-step sequences should continue or halt.
+func (step *ResolveClientIP) Run(stateBag multistep.StateBag) multistep.StepAction {
+	state := helpers.ForStateBag(stateBag)
+	ui := state.GetUI()
+
+	settings := state.GetSettings().(*config.Settings)
+	if settings.UsePrivateIPv4 {
+		return multistep.ActionContinue
+	}
+
+	if settings.ClientIP != "auto" {
+		ui.Message(fmt.Sprintf(
+			"Using client IP address '%s'.",
+			settings.ClientIP,
+		))
+
+		return multistep.ActionContinue
+	}
+
+	ui.Message(fmt.Sprintf(
+		"Discovering client's public IP address via '%s'...",
+		settings.ClientIPDiscoveryURL,
+	))
+
+	clientIP, err := helpers.DiscoverPublicIPv4Address(settings.ClientIPDiscoveryURL)
+	if err != nil {
+		ui.Error(err.Error())
+
+		return multistep.ActionHalt
+	}
+	settings.ClientIP = clientIP
+
+	ui.Message(fmt.Sprintf(
+		"Using client IP address '%s' (discovered via '%s').",
+		settings.ClientIP,
+		settings.ClientIPDiscoveryURL,
+	))
+
+	return multistep.ActionContinue
+}
+
+// Cleanup is called in reverse order of the steps that have run
+// and allow steps to clean up after themselves. Do not assume if this
+// ran that the entire multi-step sequence completed successfully. This
+// method can be ran in the face of errors and cancellations as well.
+//
+// The parameter is the same "state bag" as Run, and represents the
+// state at the latest possible time prior to calling Cleanup.
+func (step *ResolveClientIP) Cleanup(state multistep.StateBag) {
+}
+
+var _ multistep.Step = &ResolveClientIP{}
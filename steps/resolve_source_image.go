@@ -3,6 +3,9 @@ package steps
 import (
 	"fmt"
 	"log"
+	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/DimensionDataResearch/go-dd-cloud-compute/compute"
 	"github.com/DimensionDataResearch/packer-plugins-ddcloud/artifacts"
@@ -20,6 +23,27 @@ type ResolveSourceImage struct {
 
 	// If true, then the source image must be a customer image.
 	MustBeCustomerImage bool
+
+	// If specified, the source image is selected using this filter (rather than by ImageName).
+	Filter *SourceImageFilter
+}
+
+// SourceImageFilter represents the criteria used to select a source image when its exact name is not known.
+type SourceImageFilter struct {
+	// If specified, only images whose names match this regular expression are considered.
+	NamePattern *regexp.Regexp
+
+	// If specified, only images with this operating system family (e.g. "UNIX") are considered.
+	OSFamily string
+
+	// If specified, only images with this operating system Id (e.g. "UBUNTU1664") are considered.
+	OSType string
+
+	// If specified, only images of this type ("os" or "customer") are considered.
+	ImageType string
+
+	// If more than one image matches the filter, use the most recently-created one (rather than failing)?
+	MostRecent bool
 }
 
 // Run is called to perform the step's action.
@@ -31,6 +55,10 @@ func (step *ResolveSourceImage) Run(stateBag multistep.StateBag) multistep.StepA
 
 	client := state.GetClient()
 
+	if step.Filter != nil {
+		return step.resolveFilteredImage(state)
+	}
+
 	var (
 		imageType string
 		image     compute.Image
@@ -106,12 +134,193 @@ func (step *ResolveSourceImage) Run(stateBag multistep.StateBag) multistep.StepA
 
 	state.SetSourceImage(image)
 	state.SetSourceImageArtifact(&artifacts.Image{
-		Image: image,
+		Image:     image,
+		BuilderID: state.GetBuilderID(),
 	})
 
 	return multistep.ActionContinue
 }
 
+// Resolve the source image using the step's filter.
+func (step *ResolveSourceImage) resolveFilteredImage(state helpers.State) multistep.StepAction {
+	ui := state.GetUI()
+
+	client := state.GetClient()
+
+	filter := step.Filter
+	imageType := filter.ImageType
+	if step.MustBeCustomerImage {
+		if imageType == "os" {
+			state.ShowErrorMessage("The source image filter selects OS images, but a Customer image is required for this step.")
+
+			return multistep.ActionHalt
+		}
+
+		imageType = "customer"
+	}
+
+	log.Printf("Searching for images matching source image filter in datacenter '%s'.", step.DatacenterID)
+
+	var candidates []compute.Image
+	if imageType == "" || imageType == "os" {
+		osImages, err := step.findOSImages(client)
+		if err != nil {
+			state.ShowError(err)
+
+			return multistep.ActionHalt
+		}
+		candidates = append(candidates, osImages...)
+	}
+	if imageType == "" || imageType == "customer" {
+		customerImages, err := step.findCustomerImages(client)
+		if err != nil {
+			state.ShowError(err)
+
+			return multistep.ActionHalt
+		}
+		candidates = append(candidates, customerImages...)
+	}
+
+	var matchingImages []compute.Image
+	for _, candidate := range candidates {
+		if filter.matches(candidate) {
+			log.Printf("Image '%s' ('%s') matches source image filter.", candidate.GetName(), candidate.GetID())
+
+			matchingImages = append(matchingImages, candidate)
+		}
+	}
+
+	if len(matchingImages) == 0 {
+		state.ShowErrorMessage(
+			"Unable to find any image matching the source image filter (%s) in datacenter '%s'.",
+			filter,
+			step.DatacenterID,
+		)
+
+		return multistep.ActionHalt
+	}
+	if len(matchingImages) > 1 && !filter.MostRecent {
+		imageNames := make([]string, len(matchingImages))
+		for index, matchingImage := range matchingImages {
+			imageNames[index] = fmt.Sprintf("'%s' ('%s')", matchingImage.GetName(), matchingImage.GetID())
+		}
+
+		state.ShowErrorMessage(
+			"The source image filter (%s) matches %d images in datacenter '%s': %s. Refine the filter, or set 'most_recent' to use the most recently-created image.",
+			filter,
+			len(matchingImages),
+			step.DatacenterID,
+			strings.Join(imageNames, ", "),
+		)
+
+		return multistep.ActionHalt
+	}
+
+	sort.Stable(sort.Reverse(imagesByCreateTime(matchingImages)))
+	image := matchingImages[0]
+
+	ui.Message(fmt.Sprintf(
+		"Using image '%s' ('%s') as the source image (matches source image filter).",
+		image.GetName(),
+		image.GetID(),
+	))
+
+	state.SetSourceImage(image)
+	state.SetSourceImageArtifact(&artifacts.Image{
+		Image:     image,
+		BuilderID: state.GetBuilderID(),
+	})
+
+	return multistep.ActionContinue
+}
+
+// Find all OS images in the target datacenter.
+func (step *ResolveSourceImage) findOSImages(client *compute.Client) (images []compute.Image, err error) {
+	page := compute.DefaultPaging()
+	for {
+		var osImages *compute.OSImages
+		osImages, err = client.ListOSImagesInDatacenter(step.DatacenterID, page)
+		if err != nil {
+			return
+		}
+		if osImages.IsEmpty() {
+			break // We're done
+		}
+
+		for index := range osImages.Images {
+			images = append(images, &osImages.Images[index])
+		}
+
+		page.Next()
+	}
+
+	return
+}
+
+// Find all (usable) customer images in the target datacenter.
+func (step *ResolveSourceImage) findCustomerImages(client *compute.Client) (images []compute.Image, err error) {
+	page := compute.DefaultPaging()
+	for {
+		var customerImages *compute.CustomerImages
+		customerImages, err = client.ListCustomerImagesInDatacenter(step.DatacenterID, page)
+		if err != nil {
+			return
+		}
+		if customerImages.IsEmpty() {
+			break // We're done
+		}
+
+		for index := range customerImages.Images {
+			customerImage := &customerImages.Images[index]
+			if customerImage.State != "NORMAL" {
+				continue // Image is being created, deleted, etc.
+			}
+
+			images = append(images, customerImage)
+		}
+
+		page.Next()
+	}
+
+	return
+}
+
+// Determine whether the specified image matches the filter (image type is handled by the caller).
+func (filter *SourceImageFilter) matches(image compute.Image) bool {
+	if filter.NamePattern != nil && !filter.NamePattern.MatchString(image.GetName()) {
+		return false
+	}
+
+	operatingSystem := image.GetOS()
+	if filter.OSFamily != "" && !strings.EqualFold(filter.OSFamily, operatingSystem.Family) {
+		return false
+	}
+	if filter.OSType != "" && !strings.EqualFold(filter.OSType, operatingSystem.ID) {
+		return false
+	}
+
+	return true
+}
+
+// String returns a human-readable description of the filter.
+func (filter *SourceImageFilter) String() string {
+	var criteria []string
+	if filter.NamePattern != nil {
+		criteria = append(criteria, fmt.Sprintf("name matches '%s'", filter.NamePattern.String()))
+	}
+	if filter.OSFamily != "" {
+		criteria = append(criteria, fmt.Sprintf("OS family is '%s'", filter.OSFamily))
+	}
+	if filter.OSType != "" {
+		criteria = append(criteria, fmt.Sprintf("OS type is '%s'", filter.OSType))
+	}
+	if filter.ImageType != "" {
+		criteria = append(criteria, fmt.Sprintf("image type is '%s'", filter.ImageType))
+	}
+
+	return strings.Join(criteria, ", ")
+}
+
 // Cleanup is called in reverse order of the steps that have run
 // and allow steps to clean up after themselves. Do not assume if this
 // ran that the entire multi-step sequence completed successfully. This
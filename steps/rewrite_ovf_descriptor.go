@@ -0,0 +1,482 @@
+package steps
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/artifacts"
+	"github.com/DimensionDataResearch/packer-plugins-ddcloud/helpers"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+)
+
+// RewriteOVFDescriptor is the step that rewrites an OVF package's descriptor (.ovf file) so that CloudControl will accept it.
+//
+// CD / DVD drives and floppy drives are removed, unsupported network adapter types are replaced with VmxNet3,
+// and (optionally) the guest OS type and virtual hardware version are changed.
+// If the descriptor is modified, the package is staged in a working directory (the source artifact's own files are never modified),
+// and the descriptor's digest in the staged package manifest (.mf file) is updated to match.
+//
+// Expects:
+//   - OVF package files from source artifact in state from ConvertVMXToOVF / PrepareOVFManifest steps.
+type RewriteOVFDescriptor struct {
+	// If specified, the VMWare guest OS type (e.g. "ubuntu64Guest") to use.
+	GuestOSType string
+
+	// If specified, the virtual hardware version (e.g. "vmx-10") to use.
+	VirtualHardwareVersion string
+
+	// The working directory in which the package (with its rewritten descriptor) was staged.
+	workingDir string
+}
+
+// Run is called to perform the step's action.
+//
+// The return value determines whether multi-step sequences should continue or halt.
+func (step *RewriteOVFDescriptor) Run(stateBag multistep.StateBag) multistep.StepAction {
+	state := helpers.ForStateBag(stateBag)
+	ui := state.GetUI()
+
+	sourceArtifact := state.GetSourceArtifact()
+	if sourceArtifact == nil {
+		state.ShowErrorMessage("Cannot find source artifact in state data.")
+
+		return multistep.ActionHalt
+	}
+
+	ovfFile := artifacts.GetFirstFileWithExtension(".ovf", sourceArtifact)
+	if ovfFile == "" {
+		state.ShowErrorMessage("Cannot find .ovf file in source artifact '%s'.",
+			sourceArtifact.Id(),
+		)
+
+		return multistep.ActionHalt
+	}
+
+	ui.Message(fmt.Sprintf(
+		"Checking OVF descriptor '%s' for CloudControl compatibility...",
+		ovfFile,
+	))
+
+	descriptor, err := ioutil.ReadFile(ovfFile)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+
+	rewrittenDescriptor, changes, err := step.rewriteDescriptor(descriptor)
+	if err != nil {
+		state.ShowError(fmt.Errorf(
+			"Unable to process OVF descriptor '%s': %s", ovfFile, err.Error(),
+		))
+
+		return multistep.ActionHalt
+	}
+	if len(changes) == 0 {
+		ui.Message("OVF descriptor does not need to be changed.")
+
+		return multistep.ActionContinue
+	}
+
+	for _, change := range changes {
+		ui.Message(fmt.Sprintf(
+			"OVF descriptor: %s.", change,
+		))
+	}
+
+	step.workingDir, err = ioutil.TempDir(
+		"",                    // Use default temp directory
+		"packer_ovf_rewrite_", // Directory prefix
+	)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+
+	err = step.stageRewrittenPackage(ovfFile, rewrittenDescriptor, sourceArtifact)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+
+	ovfArtifact, err := artifacts.NewFromFilesInLocalDirectory(
+		step.workingDir,
+		sourceArtifact.BuilderId(),
+	)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
+	state.SetSourceArtifact(ovfArtifact)
+
+	ui.Message(fmt.Sprintf(
+		"Staged OVF package with rewritten descriptor '%s'.",
+		path.Base(ovfFile),
+	))
+
+	return multistep.ActionContinue
+}
+
+// Cleanup is called in reverse order of the steps that have run
+// and allow steps to clean up after themselves. Do not assume if this
+// ran that the entire multi-step sequence completed successfully. This
+// method can be ran in the face of errors and cancellations as well.
+//
+// The parameter is the same "state bag" as Run, and represents the
+// state at the latest possible time prior to calling Cleanup.
+func (step *RewriteOVFDescriptor) Cleanup(stateBag multistep.StateBag) {
+	if step.workingDir == "" {
+		return // Nothing to do.
+	}
+
+	state := helpers.ForStateBag(stateBag)
+
+	err := os.RemoveAll(step.workingDir)
+	if err != nil && !os.IsNotExist(err) {
+		state.SetLastError(err)
+		state.GetUI().Error(
+			err.Error(),
+		)
+	}
+
+	step.workingDir = ""
+}
+
+var _ multistep.Step = &RewriteOVFDescriptor{}
+
+// Stage the OVF package in the working directory, with the rewritten descriptor (and an updated manifest, if the package has one).
+//
+// The other package files are hard-linked (or copied); they are never modified.
+func (step *RewriteOVFDescriptor) stageRewrittenPackage(ovfFile string, rewrittenDescriptor []byte, sourceArtifact packer.Artifact) error {
+	referencedFileNames, err := readOVFFileReferences(ovfFile)
+	if err != nil {
+		return err
+	}
+	packageFiles, err := getOVFPackageFiles(ovfFile, referencedFileNames, sourceArtifact)
+	if err != nil {
+		return err
+	}
+
+	targetOVFFile := path.Join(step.workingDir, path.Base(ovfFile))
+	for _, packageFile := range packageFiles {
+		if packageFile == ovfFile {
+			continue
+		}
+
+		err = linkOrCopyFile(packageFile,
+			path.Join(step.workingDir, path.Base(packageFile)),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	err = ioutil.WriteFile(targetOVFFile, rewrittenDescriptor, 0644 /* u=rw,go=r */)
+	if err != nil {
+		return err
+	}
+
+	manifestFile := artifacts.GetFirstFileWithExtension(".mf", sourceArtifact)
+	if manifestFile == "" {
+		return nil // No manifest to update.
+	}
+
+	return updateManifestDigest(manifestFile,
+		path.Join(step.workingDir, path.Base(manifestFile)),
+		targetOVFFile,
+	)
+}
+
+// The XML namespace for VMWare-specific OVF extensions.
+const vmwareOVFNamespace = "http://www.vmware.com/schema/ovf"
+
+// CIM resource types for devices that CloudControl does not support.
+var unsupportedOVFResourceTypes = map[string]string{
+	"14": "floppy drive",
+	"15": "CD drive",
+	"16": "DVD drive",
+}
+
+// CIM resource type for network adapters.
+const ovfNetworkAdapterResourceType = "10"
+
+// Network adapter types supported by CloudControl.
+var supportedOVFNetworkAdapterTypes = []string{"VmxNet3", "E1000", "E1000e"}
+
+// The network adapter type used in place of unsupported types.
+const defaultOVFNetworkAdapterType = "VmxNet3"
+
+var ovfOSTypeAttributePattern = regexp.MustCompile(`\s[A-Za-z0-9_.-]+:osType="[^"]*"`)
+
+// ovfEdit represents a change to a range of bytes in an OVF descriptor.
+type ovfEdit struct {
+	Start       int64
+	End         int64
+	Replacement string
+}
+
+// ovfItem represents the information about an OVF virtual hardware item that is used to determine whether it needs to be changed.
+type ovfItem struct {
+	Start          int64
+	ElementName    string
+	ResourceType   string
+	SubType        string
+	SubTypeStart   int64
+	SubTypeEnd     int64
+	HaveSubTypeEnd bool
+}
+
+// Rewrite the OVF descriptor, returning the rewritten descriptor and a description of each change made.
+//
+// The descriptor is edited in-place (rather than being deserialised and then re-serialised) so that content this step does not understand is preserved as-is.
+func (step *RewriteOVFDescriptor) rewriteDescriptor(descriptor []byte) (rewrittenDescriptor []byte, changes []string, err error) {
+	var (
+		edits        []ovfEdit
+		item         *ovfItem
+		elementStack []string
+		textStart    int64
+
+		// For each element in elementStack, is the "vmw" prefix bound to the VMWare namespace?
+		vmwareNamespaceStack []bool
+	)
+
+	decoder := xml.NewDecoder(bytes.NewReader(descriptor))
+	for {
+		tokenStart := decoder.InputOffset()
+
+		var token xml.Token
+		token, err = decoder.Token()
+		if err == io.EOF {
+			err = nil
+
+			break // We're done
+		}
+		if err != nil {
+			return
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			vmwareNamespaceDeclared := len(vmwareNamespaceStack) > 0 && vmwareNamespaceStack[len(vmwareNamespaceStack)-1]
+			for _, attribute := range element.Attr {
+				if attribute.Name.Space == "xmlns" && attribute.Name.Local == "vmw" {
+					vmwareNamespaceDeclared = attribute.Value == vmwareOVFNamespace
+				}
+			}
+
+			elementStack = append(elementStack, element.Name.Local)
+			vmwareNamespaceStack = append(vmwareNamespaceStack, vmwareNamespaceDeclared)
+			textStart = decoder.InputOffset()
+
+			switch element.Name.Local {
+			case "Item", "StorageItem", "EthernetPortItem":
+				item = &ovfItem{
+					Start: tokenStart,
+				}
+			case "ResourceSubType":
+				if item != nil {
+					item.SubTypeStart = textStart
+				}
+			case "OperatingSystemSection":
+				if step.GuestOSType == "" {
+					break
+				}
+
+				edit, change := step.rewriteGuestOSType(element, descriptor[tokenStart:textStart], vmwareNamespaceDeclared)
+				if change != "" {
+					edit.Start = tokenStart
+					edit.End = textStart
+					edits = append(edits, edit)
+					changes = append(changes, change)
+				}
+			}
+		case xml.CharData:
+			if item == nil || len(elementStack) == 0 {
+				break
+			}
+
+			text := strings.TrimSpace(string(element))
+			switch elementStack[len(elementStack)-1] {
+			case "ElementName":
+				item.ElementName = text
+			case "ResourceType":
+				item.ResourceType = text
+			case "ResourceSubType":
+				item.SubType = text
+			}
+		case xml.EndElement:
+			if len(elementStack) > 0 {
+				elementStack = elementStack[:len(elementStack)-1]
+				vmwareNamespaceStack = vmwareNamespaceStack[:len(vmwareNamespaceStack)-1]
+			}
+
+			switch element.Name.Local {
+			case "ResourceSubType":
+				if item != nil {
+					item.SubTypeEnd = tokenStart
+					item.HaveSubTypeEnd = true
+				}
+			case "VirtualSystemType":
+				if step.VirtualHardwareVersion == "" || tokenStart <= textStart {
+					break
+				}
+
+				currentVersion := strings.TrimSpace(string(descriptor[textStart:tokenStart]))
+				if currentVersion == step.VirtualHardwareVersion {
+					break
+				}
+
+				edits = append(edits, ovfEdit{
+					Start:       textStart,
+					End:         tokenStart,
+					Replacement: escapeXMLText(step.VirtualHardwareVersion),
+				})
+				changes = append(changes, fmt.Sprintf(
+					"changed virtual hardware version from '%s' to '%s'", currentVersion, step.VirtualHardwareVersion,
+				))
+			case "Item", "StorageItem", "EthernetPortItem":
+				if item == nil {
+					break
+				}
+
+				itemEnd := decoder.InputOffset()
+				edit, change := rewriteOVFItem(item, itemEnd, descriptor)
+				if change != "" {
+					edits = append(edits, edit)
+					changes = append(changes, change)
+				}
+
+				item = nil
+			}
+		}
+	}
+
+	// Edits are in document order, so apply them from the end of the descriptor backwards.
+	rewrittenDescriptor = descriptor
+	for index := len(edits) - 1; index >= 0; index-- {
+		edit := edits[index]
+
+		var buffer bytes.Buffer
+		buffer.Write(rewrittenDescriptor[:edit.Start])
+		buffer.WriteString(edit.Replacement)
+		buffer.Write(rewrittenDescriptor[edit.End:])
+		rewrittenDescriptor = buffer.Bytes()
+	}
+
+	return
+}
+
+// Determine whether a virtual hardware item needs to be removed or changed.
+func rewriteOVFItem(item *ovfItem, itemEnd int64, descriptor []byte) (edit ovfEdit, change string) {
+	if deviceType, unsupported := unsupportedOVFResourceTypes[item.ResourceType]; unsupported {
+		// Also remove the indentation before the item.
+		itemStart := item.Start
+		for itemStart > 0 && (descriptor[itemStart-1] == ' ' || descriptor[itemStart-1] == '\t') {
+			itemStart--
+		}
+		if itemStart > 0 && descriptor[itemStart-1] == '\n' {
+			itemStart--
+		}
+
+		edit = ovfEdit{
+			Start: itemStart,
+			End:   itemEnd,
+		}
+		change = fmt.Sprintf("removed %s '%s'", deviceType, item.ElementName)
+
+		return
+	}
+
+	if item.ResourceType != ovfNetworkAdapterResourceType || !item.HaveSubTypeEnd || item.SubTypeEnd <= item.SubTypeStart {
+		return
+	}
+	for _, supportedType := range supportedOVFNetworkAdapterTypes {
+		if strings.EqualFold(item.SubType, supportedType) {
+			return
+		}
+	}
+
+	edit = ovfEdit{
+		Start:       item.SubTypeStart,
+		End:         item.SubTypeEnd,
+		Replacement: defaultOVFNetworkAdapterType,
+	}
+	change = fmt.Sprintf("changed network adapter '%s' type from '%s' to '%s'",
+		item.ElementName, item.SubType, defaultOVFNetworkAdapterType,
+	)
+
+	return
+}
+
+// Determine whether the guest OS type (in an OperatingSystemSection start tag) needs to be changed.
+//
+// If the "vmw" prefix is not already bound to the VMWare namespace (on this element or an ancestor), a namespace declaration is added to the start tag.
+func (step *RewriteOVFDescriptor) rewriteGuestOSType(element xml.StartElement, startTag []byte, vmwareNamespaceDeclared bool) (edit ovfEdit, change string) {
+	currentOSType := ""
+	for _, attribute := range element.Attr {
+		if attribute.Name.Space == vmwareOVFNamespace && attribute.Name.Local == "osType" {
+			currentOSType = attribute.Value
+		}
+	}
+	if currentOSType == step.GuestOSType {
+		return
+	}
+
+	// Remove the existing attribute (if any), then add the new one at the end of the start tag.
+	tag := ovfOSTypeAttributePattern.ReplaceAllString(string(startTag), "")
+	osTypeAttribute := fmt.Sprintf(` vmw:osType="%s"`, escapeXMLText(step.GuestOSType))
+	if !vmwareNamespaceDeclared && !strings.Contains(tag, "xmlns:vmw=") {
+		osTypeAttribute = fmt.Sprintf(` xmlns:vmw="%s"`, vmwareOVFNamespace) + osTypeAttribute
+	}
+	tagEnd := strings.LastIndex(tag, ">")
+	if strings.HasSuffix(tag, "/>") {
+		tagEnd--
+	}
+	edit.Replacement = tag[:tagEnd] + osTypeAttribute + tag[tagEnd:]
+
+	if currentOSType == "" {
+		change = fmt.Sprintf("set guest OS type to '%s'", step.GuestOSType)
+	} else {
+		change = fmt.Sprintf("changed guest OS type from '%s' to '%s'", currentOSType, step.GuestOSType)
+	}
+
+	return
+}
+
+// Escape text for inclusion in an XML document.
+func escapeXMLText(text string) string {
+	var buffer bytes.Buffer
+	xml.EscapeText(&buffer, []byte(text))
+
+	return buffer.String()
+}
+
+// Update the digest for the specified package file in an OVF manifest, writing the updated manifest to a new file.
+func updateManifestDigest(manifestFile string, targetManifestFile string, packageFile string) error {
+	manifest, err := helpers.ReadOVFManifest(manifestFile)
+	if err != nil {
+		return err
+	}
+
+	entry := manifest.GetEntry(path.Base(packageFile))
+	if entry == nil {
+		return fmt.Errorf("OVF manifest '%s' has no entry for file '%s'", manifestFile, path.Base(packageFile))
+	}
+
+	entry.Digest, err = helpers.ComputeFileDigest(packageFile, entry.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	return manifest.Write(targetManifestFile)
+}
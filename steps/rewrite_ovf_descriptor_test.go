@@ -0,0 +1,167 @@
+package steps
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRewriteOVFDescriptor(test *testing.T) {
+	testCases := []struct {
+		name                   string
+		sourceFile             string
+		guestOSType            string
+		virtualHardwareVersion string
+
+		// If specified, the rewritten descriptor must be identical to this file.
+		expectedFile string
+
+		// If specified, the rewritten descriptor must contain each of these.
+		expectedContent []string
+
+		expectedChanges []string
+	}{
+		{
+			name:         "remove CD and floppy drives, and replace network adapter type",
+			sourceFile:   "vmware.ovf",
+			expectedFile: "vmware.rewritten.ovf",
+			expectedChanges: []string{
+				"removed CD drive 'cdrom0'",
+				"changed network adapter 'ethernet0' type from 'PCNet32' to 'VmxNet3'",
+				"removed floppy drive 'floppy0'",
+			},
+		},
+		{
+			name:                   "guest OS type and virtual hardware version already match",
+			sourceFile:             "vmware.ovf",
+			guestOSType:            "ubuntu64Guest",
+			virtualHardwareVersion: "vmx-08",
+			expectedFile:           "vmware.rewritten.ovf",
+			expectedChanges: []string{
+				"removed CD drive 'cdrom0'",
+				"changed network adapter 'ethernet0' type from 'PCNet32' to 'VmxNet3'",
+				"removed floppy drive 'floppy0'",
+			},
+		},
+		{
+			name:                   "change guest OS type and virtual hardware version",
+			sourceFile:             "vmware.ovf",
+			guestOSType:            "centos64Guest",
+			virtualHardwareVersion: "vmx-10",
+			expectedContent: []string{
+				`<OperatingSystemSection ovf:id="94" vmw:osType="centos64Guest">`,
+				`<vssd:VirtualSystemType>vmx-10</vssd:VirtualSystemType>`,
+			},
+			expectedChanges: []string{
+				"changed guest OS type from 'ubuntu64Guest' to 'centos64Guest'",
+				"changed virtual hardware version from 'vmx-08' to 'vmx-10'",
+				"removed CD drive 'cdrom0'",
+				"changed network adapter 'ethernet0' type from 'PCNet32' to 'VmxNet3'",
+				"removed floppy drive 'floppy0'",
+			},
+		},
+		{
+			name:         "no changes",
+			sourceFile:   "compatible.ovf",
+			expectedFile: "compatible.ovf",
+		},
+		{
+			name:                   "virtual hardware version already matches",
+			sourceFile:             "compatible.ovf",
+			virtualHardwareVersion: "vmx-10",
+			expectedFile:           "compatible.ovf",
+		},
+		{
+			name:        "add guest OS type to self-closing section without VMWare namespace",
+			sourceFile:  "compatible.ovf",
+			guestOSType: "otherLinux64Guest",
+			expectedContent: []string{
+				`<OperatingSystemSection ovf:id="101" xmlns:vmw="http://www.vmware.com/schema/ovf" vmw:osType="otherLinux64Guest"/>`,
+			},
+			expectedChanges: []string{
+				"set guest OS type to 'otherLinux64Guest'",
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		descriptor := readTestData(test, testCase.sourceFile)
+
+		step := &RewriteOVFDescriptor{
+			GuestOSType:            testCase.guestOSType,
+			VirtualHardwareVersion: testCase.virtualHardwareVersion,
+		}
+		rewrittenDescriptor, changes, err := step.rewriteDescriptor(descriptor)
+		if err != nil {
+			test.Errorf("%s: unexpected error: %s", testCase.name, err.Error())
+
+			continue
+		}
+
+		if !reflect.DeepEqual(changes, testCase.expectedChanges) {
+			test.Errorf("%s: changes are %#v (expected %#v)", testCase.name, changes, testCase.expectedChanges)
+		}
+		if testCase.expectedFile != "" {
+			expectedDescriptor := readTestData(test, testCase.expectedFile)
+			if !bytes.Equal(rewrittenDescriptor, expectedDescriptor) {
+				test.Errorf("%s: rewritten descriptor does not match '%s':\n%s", testCase.name, testCase.expectedFile, rewrittenDescriptor)
+			}
+		}
+		for _, expectedContent := range testCase.expectedContent {
+			if !bytes.Contains(rewrittenDescriptor, []byte(expectedContent)) {
+				test.Errorf("%s: rewritten descriptor does not contain '%s':\n%s", testCase.name, expectedContent, rewrittenDescriptor)
+			}
+		}
+
+		guestOSType, err := readTestGuestOSType(rewrittenDescriptor)
+		if err != nil {
+			test.Errorf("%s: rewritten descriptor is not valid XML: %s", testCase.name, err.Error())
+
+			continue
+		}
+		if testCase.guestOSType != "" && guestOSType != testCase.guestOSType {
+			test.Errorf("%s: guest OS type is '%s' (expected '%s')", testCase.name, guestOSType, testCase.guestOSType)
+		}
+	}
+}
+
+func readTestData(test *testing.T, fileName string) []byte {
+	data, err := ioutil.ReadFile(path.Join("testdata", fileName))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	return data
+}
+
+// Parse an OVF descriptor, and return its (VMWare-specific) guest OS type.
+func readTestGuestOSType(descriptor []byte) (guestOSType string, err error) {
+	decoder := xml.NewDecoder(bytes.NewReader(descriptor))
+	for {
+		var token xml.Token
+		token, err = decoder.Token()
+		if err == io.EOF {
+			err = nil
+
+			return
+		}
+		if err != nil {
+			return
+		}
+
+		element, ok := token.(xml.StartElement)
+		if !ok || element.Name.Local != "OperatingSystemSection" {
+			continue
+		}
+		for _, attribute := range element.Attr {
+			if attribute.Name.Space == vmwareOVFNamespace && strings.EqualFold(attribute.Name.Local, "osType") {
+				guestOSType = attribute.Value
+			}
+		}
+	}
+}
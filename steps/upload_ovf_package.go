@@ -1,11 +1,14 @@
 package steps
 
 import (
+	"crypto/tls"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"log"
-	"os"
 	"path"
 	"strings"
+	"sync"
 
 	"github.com/DimensionDataResearch/packer-plugins-ddcloud/artifacts"
 	"github.com/DimensionDataResearch/packer-plugins-ddcloud/helpers"
@@ -19,8 +22,32 @@ import (
 //   - Target data center in state from ResolveDatacenter step.
 //   - OVF package files from source artifact in state from ConvertVMXToOVF step.
 type UploadOVFPackage struct {
-	// The path to the "curl" executable.
-	CurlExecutable string
+	// The path of a file containing (PEM-encoded) CA certificates used to verify the FTPS host's certificate.
+	//
+	// If not specified, the system CA certificates are used.
+	FTPSCACertFile string
+
+	// Skip verification of the FTPS host's certificate?
+	FTPSSkipVerify bool
+
+	// The maximum number of files to upload in parallel (defaults to 1).
+	Parallelism int
+
+	// Resume partially-uploaded files (e.g. from an interrupted build)?
+	//
+	// An existing remote file is only resumed if its content matches the start of the local file (it is downloaded and compared first).
+	// Otherwise, all files are uploaded from the start (replacing any existing files with the same names).
+	ResumeUploads bool
+
+	// Retain the uploaded package files once the step sequence has completed successfully?
+	//
+	// Uploaded package files are always deleted if the step sequence fails.
+	KeepPackage bool
+
+	ftpsHostName      string
+	tlsConfig         *tls.Config
+	uploadedFiles     []string
+	uploadedFilesLock sync.Mutex
 }
 
 // Run is called to perform the step's action.
@@ -30,11 +57,6 @@ func (step *UploadOVFPackage) Run(stateBag multistep.StateBag) multistep.StepAct
 	state := helpers.ForStateBag(stateBag)
 	ui := state.GetUI()
 
-	// Auto-detect tool location if not already specified.
-	if step.CurlExecutable == "" {
-		step.CurlExecutable = "curl"
-	}
-
 	targetDatacenter := state.GetTargetDatacenter()
 	if targetDatacenter == nil {
 		state.ShowErrorMessage("Cannot found target datacenter in state data.")
@@ -68,15 +90,37 @@ func (step *UploadOVFPackage) Run(stateBag multistep.StateBag) multistep.StepAct
 		return multistep.ActionHalt
 	}
 
-	settings := state.GetSettings()
+	manifest, err := helpers.ReadOVFManifest(
+		artifacts.GetFirstFileWithExtension(".mf", sourceArtifact),
+	)
+	if err != nil {
+		state.ShowError(err)
+
+		return multistep.ActionHalt
+	}
 
-	curlTool, err := step.createCurlTool(ui)
+	tlsConfig, err := helpers.CreateFTPSTLSConfig(targetDatacenter.FTPSHost, step.FTPSCACertFile, step.FTPSSkipVerify)
 	if err != nil {
 		state.ShowError(err)
 
 		return multistep.ActionHalt
 	}
 
+	step.ftpsHostName = targetDatacenter.FTPSHost
+	step.tlsConfig = tlsConfig
+
+	parallelism := step.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	var (
+		uploadErrors     error
+		uploadErrorsLock sync.Mutex
+		uploadGroup      sync.WaitGroup
+	)
+	uploadSlots := make(chan bool, parallelism)
+
 	packageBaseName := ""
 	for _, sourceFile := range sourceFiles {
 		if !isOVFPackageFile(sourceFile) {
@@ -86,47 +130,30 @@ func (step *UploadOVFPackage) Run(stateBag multistep.StateBag) multistep.StepAct
 		}
 
 		targetFileName := path.Base(sourceFile)
-		ui.Message(fmt.Sprintf(
-			"Uploading '%s'...", targetFileName,
-		))
-
 		if strings.HasSuffix(targetFileName, ".ovf") {
-			packageBaseName = strings.Replace(targetFileName, ".ofv", "", 1)
+			packageBaseName = strings.TrimSuffix(targetFileName, ".ovf")
 		}
 
-		success, err := curlTool.Run(
-			"-s", // No progress bar
-			"-S", // But still show errors
-			"--user",
-			fmt.Sprintf("%s:%s",
-				settings.GetMCPUser(),
-				settings.GetMCPPassword(),
-			),
-			"--upload-file",
-			sourceFile,
-			"--ssl", // FTPS
-			fmt.Sprintf("ftp://%s/%s",
-				targetDatacenter.FTPSHost,
-				targetFileName,
-			),
-		)
-		if err != nil {
-			state.ShowError(err)
-
-			return multistep.ActionHalt
-		}
-		if !success {
-			state.ShowErrorMessage("Failed to upload file '%s' to '%s'",
-				sourceFile,
-				targetDatacenter.FTPSHost,
-			)
+		uploadGroup.Add(1)
+		uploadSlots <- true
+		go func(sourceFile string) {
+			defer uploadGroup.Done()
+			defer func() { <-uploadSlots }()
+
+			uploadError := step.uploadFile(sourceFile, targetDatacenter.FTPSHost, tlsConfig, manifest, state)
+			if uploadError != nil {
+				uploadErrorsLock.Lock()
+				uploadErrors = packer.MultiErrorAppend(uploadErrors, uploadError)
+				uploadErrorsLock.Unlock()
+			}
+		}(sourceFile)
+	}
+	uploadGroup.Wait()
 
-			return multistep.ActionHalt
-		}
+	if uploadErrors != nil {
+		state.ShowError(uploadErrors)
 
-		ui.Message(fmt.Sprintf(
-			"Uploaded '%s'.", targetFileName,
-		))
+		return multistep.ActionHalt
 	}
 
 	ui.Message(fmt.Sprintf(
@@ -134,11 +161,15 @@ func (step *UploadOVFPackage) Run(stateBag multistep.StateBag) multistep.StepAct
 		targetDatacenter.ID,
 	))
 
-	state.SetRemoteOVFPackageArtifact(&artifacts.RemoteOVFPackage{
-		FTPSHostName:  targetDatacenter.FTPSHost,
-		PackagePrefix: packageBaseName,
-		BuilderID:     "ddcloud.ovf",
-	})
+	state.SetRemoteOVFPackageArtifact(artifacts.NewRemoteOVFPackage(
+		targetDatacenter.FTPSHost,
+		packageBaseName,
+		step.uploadedFiles,
+		"ddcloud.ovf",
+		func() error {
+			return step.deleteUploadedFiles(state)
+		},
+	))
 
 	return multistep.ActionContinue
 }
@@ -150,11 +181,117 @@ func (step *UploadOVFPackage) Run(stateBag multistep.StateBag) multistep.StepAct
 //
 // The parameter is the same "state bag" as Run, and represents the
 // state at the latest possible time prior to calling Cleanup.
-func (step *UploadOVFPackage) Cleanup(state multistep.StateBag) {
+func (step *UploadOVFPackage) Cleanup(stateBag multistep.StateBag) {
+	state := helpers.ForStateBag(stateBag)
+	ui := state.GetUI()
+
+	if len(step.uploadedFiles) == 0 {
+		return // Nothing to do.
+	}
+
+	_, cancelled := state.GetOk(multistep.StateCancelled)
+	_, halted := state.GetOk(multistep.StateHalted)
+	if step.KeepPackage && !(cancelled || halted) {
+		return // Retain package files.
+	}
+
+	ui.Message(fmt.Sprintf(
+		"Deleting uploaded OVF package files from '%s'...",
+		step.ftpsHostName,
+	))
+
+	var err error
+	packageArtifact := state.GetRemoteOVFPackageArtifact()
+	if packageArtifact != nil {
+		err = packageArtifact.Destroy()
+	} else {
+		err = step.deleteUploadedFiles(state)
+	}
+	if err != nil {
+		ui.Error(err.Error())
+
+		return
+	}
+
+	ui.Message(fmt.Sprintf(
+		"Deleted uploaded OVF package files from '%s'.",
+		step.ftpsHostName,
+	))
 }
 
 var _ multistep.Step = &UploadOVFPackage{}
 
+// Upload a single OVF package file (using its own FTPS connection), optionally resuming any partial upload, and verify its digest against the package manifest.
+func (step *UploadOVFPackage) uploadFile(sourceFile string, ftpsHostName string, tlsConfig *tls.Config, manifest *helpers.OVFManifest, state helpers.State) error {
+	ui := state.GetUI()
+	settings := state.GetSettings()
+
+	targetFileName := path.Base(sourceFile)
+
+	// The manifest can't contain its own digest.
+	var (
+		manifestEntry *helpers.OVFManifestEntry
+		digest        hash.Hash
+		err           error
+	)
+	if !strings.HasSuffix(targetFileName, ".mf") {
+		manifestEntry = manifest.GetEntry(targetFileName)
+		if manifestEntry == nil {
+			return fmt.Errorf("OVF manifest has no entry for file '%s'", targetFileName)
+		}
+
+		digest, err = helpers.NewDigestHasher(manifestEntry.Algorithm)
+		if err != nil {
+			return err
+		}
+	}
+
+	ftpsClient, err := helpers.ConnectFTPS(ftpsHostName, settings.GetMCPUser(), settings.GetMCPPassword(), tlsConfig)
+	if err != nil {
+		return err
+	}
+	defer ftpsClient.Close()
+
+	// Track the file before uploading it, so that partial uploads are also cleaned up.
+	step.uploadedFilesLock.Lock()
+	step.uploadedFiles = append(step.uploadedFiles, targetFileName)
+	step.uploadedFilesLock.Unlock()
+
+	ui.Message(fmt.Sprintf(
+		"Uploading '%s'...", targetFileName,
+	))
+
+	resumedFrom, err := ftpsClient.Upload(sourceFile, targetFileName, step.ResumeUploads, digest,
+		newTransferProgressReporter(ui, "Uploading", targetFileName),
+	)
+	if err != nil {
+		return err
+	}
+	if resumedFrom > 0 {
+		log.Printf("UploadOVFPackage: resumed upload of '%s' from offset %d.", targetFileName, resumedFrom)
+	}
+
+	if manifestEntry != nil {
+		actualDigest := hex.EncodeToString(
+			digest.Sum(nil),
+		)
+		if actualDigest != manifestEntry.Digest {
+			return fmt.Errorf("%s digest of uploaded file '%s' does not match OVF manifest (expected '%s', but was '%s')",
+				manifestEntry.Algorithm,
+				targetFileName,
+				manifestEntry.Digest,
+				actualDigest,
+			)
+		}
+	}
+
+	ui.Message(fmt.Sprintf(
+		"Uploaded '%s'.", targetFileName,
+	))
+
+	return nil
+}
+
 // Is the specified file part of an OVF package (from Cloud Control's point of view)?
 func isOVFPackageFile(fileName string) bool {
 	return strings.HasSuffix(fileName, ".vmdk") ||
@@ -192,13 +329,57 @@ func (step *UploadOVFPackage) validateOVFPackageFiles(packageFiles []string) (er
 	return
 }
 
-func (step *UploadOVFPackage) createCurlTool(ui packer.Ui) (*helpers.Tool, error) {
-	workDir, _ := os.Getwd()
+// Delete the files uploaded by this step from the FTPS host.
+func (step *UploadOVFPackage) deleteUploadedFiles(state helpers.State) error {
+	settings := state.GetSettings()
+
+	step.uploadedFilesLock.Lock()
+	defer step.uploadedFilesLock.Unlock()
+
+	if len(step.uploadedFiles) == 0 {
+		return nil // Already deleted.
+	}
+
+	ftpsClient, err := helpers.ConnectFTPS(step.ftpsHostName, settings.GetMCPUser(), settings.GetMCPPassword(), step.tlsConfig)
+	if err != nil {
+		return err
+	}
+	defer ftpsClient.Close()
+
+	var remainingFiles []string
+	for _, uploadedFile := range step.uploadedFiles {
+		deleteError := ftpsClient.Delete(uploadedFile)
+		if deleteError != nil {
+			err = packer.MultiErrorAppend(err, deleteError)
+			remainingFiles = append(remainingFiles, uploadedFile)
+
+			continue
+		}
+
+		log.Printf("UploadOVFPackage: deleted '%s' from '%s'.", uploadedFile, step.ftpsHostName)
+	}
+	step.uploadedFiles = remainingFiles
+
+	return err
+}
+
+// Create an FTPSProgressHandler that reports transfer progress (in 10% increments) via the UI.
+func newTransferProgressReporter(ui packer.Ui, action string, fileName string) helpers.FTPSProgressHandler {
+	lastReportedPercent := int64(0)
+
+	return func(transferredBytes int64, totalBytes int64) {
+		if totalBytes <= 0 {
+			return
+		}
+
+		percent := (transferredBytes * 100 / totalBytes) / 10 * 10
+		if percent <= lastReportedPercent || percent >= 100 {
+			return
+		}
+		lastReportedPercent = percent
 
-	return helpers.ForTool(step.CurlExecutable, workDir, func(programOutput string) {
 		ui.Message(fmt.Sprintf(
-			"[curl] %s",
-			programOutput,
+			"%s '%s' (%d%%)...", action, fileName, percent,
 		))
-	})
+	}
 }